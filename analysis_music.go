@@ -0,0 +1,14 @@
+// +build !wasm
+
+package gfx
+
+// AnalyzeMusic decodes the complete music and analyses it for each frame.
+// All formats supported by RunTimedMusic can be analysed.
+// See AnalyzeAudio for the bins parameter.
+func AnalyzeMusic(path string, frameRate float64, bins int) (*AnalysisTrack, error) {
+	samples, rate, err := decodeAllMusic(path)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeAudio(samples, rate, frameRate, bins), nil
+}
@@ -0,0 +1,229 @@
+package gfx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// AnalysisFrame is the analysis of a single frame in an AnalysisTrack.
+type AnalysisFrame struct {
+	RMS      float32
+	Bands    [NumBands]float32
+	Spectrum []float32
+}
+
+// AnalysisTrack is audio analysis precomputed for every frame.
+// It implements Analyzer, so effects get the same result in the preview
+// and when writing frames to disk.
+// Use the gfxaudio command or AnalyzeMusic to create one.
+type AnalysisTrack struct {
+	FrameRate  float64
+	SampleRate int
+
+	// BinHz is the frequency width of each bin in the spectrum of the frames.
+	BinHz float64
+
+	Frames []AnalysisFrame
+
+	// Onsets contains the sample position of all onsets.
+	Onsets []int64
+}
+
+const analysisMagic = "GFXAUDIO\x01"
+
+// AnalyzeAudio analyses stereo samples for each frame.
+// The spectrum is reduced to the given number of bins.
+// If bins is 0 the full spectrum is kept.
+func AnalyzeAudio(samples [][2]float64, sampleRate int, frameRate float64, bins int) *AnalysisTrack {
+	a := newAudioAnalyzer(sampleRate, len(samples))
+	a.write(samples)
+	full := analysisWindow / 2
+	if bins <= 0 || bins > full {
+		bins = full
+	}
+	t := &AnalysisTrack{
+		FrameRate:  frameRate,
+		SampleRate: sampleRate,
+		BinHz:      float64(sampleRate) / 2 / float64(bins),
+		Onsets:     a.onsets,
+	}
+	n := int(math.Ceil(float64(len(samples)) * frameRate / float64(sampleRate)))
+	t.Frames = make([]AnalysisFrame, n)
+	for i := range t.Frames {
+		res := a.Analyze(t.frameTime(i))
+		f := &t.Frames[i]
+		f.RMS = float32(res.RMS)
+		for b, v := range res.Bands {
+			f.Bands[b] = float32(v)
+		}
+		// Average the spectrum into the bins.
+		f.Spectrum = make([]float32, bins)
+		for b := range f.Spectrum {
+			lo, hi := b*full/bins, (b+1)*full/bins
+			var sum float64
+			for _, v := range res.Spectrum[lo:hi] {
+				sum += v
+			}
+			f.Spectrum[b] = float32(sum / float64(hi-lo))
+		}
+	}
+	return t
+}
+
+func (t *AnalysisTrack) frameTime(i int) time.Duration {
+	return time.Duration(float64(i) * float64(time.Second) / t.FrameRate)
+}
+
+// Analyze returns the analysis of the frame at pos.
+func (t *AnalysisTrack) Analyze(pos time.Duration) AudioAnalysis {
+	res := AudioAnalysis{SinceOnset: -1, BinHz: t.BinHz}
+	i := int(pos.Seconds() * t.FrameRate)
+	if i < 0 || i >= len(t.Frames) {
+		return res
+	}
+	f := &t.Frames[i]
+	res.RMS = float64(f.RMS)
+	for b, v := range f.Bands {
+		res.Bands[b] = float64(v)
+	}
+	res.Spectrum = make([]float64, len(f.Spectrum))
+	for b, v := range f.Spectrum {
+		res.Spectrum[b] = float64(v)
+	}
+	// Use the frame time, so all positions within a frame give the same result.
+	end := int64(t.frameTime(i)) * int64(t.SampleRate) / int64(time.Second)
+	j := sort.Search(len(t.Onsets), func(j int) bool { return t.Onsets[j] > end })
+	if j > 0 {
+		res.SinceOnset = time.Duration((end - t.Onsets[j-1]) * int64(time.Second) / int64(t.SampleRate))
+		res.Onset = res.SinceOnset < time.Duration(float64(time.Second)/t.FrameRate)
+	}
+	return res
+}
+
+// analysisHeader is the fixed size header of a stored track.
+type analysisHeader struct {
+	FrameRate  float64
+	SampleRate uint32
+	Bins       uint32
+	Frames     uint32
+	Onsets     uint32
+}
+
+// WriteTo writes the track to w.
+func (t *AnalysisTrack) WriteTo(w io.Writer) (int64, error) {
+	bins := 0
+	if len(t.Frames) > 0 {
+		bins = len(t.Frames[0].Spectrum)
+	}
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	le := binary.LittleEndian
+	cw.Write([]byte(analysisMagic))
+	binary.Write(cw, le, analysisHeader{
+		FrameRate:  t.FrameRate,
+		SampleRate: uint32(t.SampleRate),
+		Bins:       uint32(bins),
+		Frames:     uint32(len(t.Frames)),
+		Onsets:     uint32(len(t.Onsets)),
+	})
+	binary.Write(cw, le, t.Onsets)
+	for _, f := range t.Frames {
+		if len(f.Spectrum) != bins {
+			return cw.n, errors.New("analysis: frames have different spectrum sizes")
+		}
+		binary.Write(cw, le, f.RMS)
+		binary.Write(cw, le, f.Bands)
+		binary.Write(cw, le, f.Spectrum)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.(*bufio.Writer).Flush()
+}
+
+// countWriter counts bytes written and keeps the first error.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// ErrAnalysisFormat is returned when analysis data cannot be read.
+var ErrAnalysisFormat = errors.New("analysis: unknown format")
+
+// ReadAnalysisTrack reads a track written by WriteTo.
+func ReadAnalysisTrack(r io.Reader) (*AnalysisTrack, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(analysisMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != analysisMagic {
+		return nil, ErrAnalysisFormat
+	}
+	le := binary.LittleEndian
+	var hdr analysisHeader
+	if err := binary.Read(br, le, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.FrameRate <= 0 || hdr.SampleRate == 0 || hdr.Bins > analysisWindow/2 {
+		return nil, ErrAnalysisFormat
+	}
+	t := &AnalysisTrack{
+		FrameRate:  hdr.FrameRate,
+		SampleRate: int(hdr.SampleRate),
+		Onsets:     []int64{},
+	}
+	if hdr.Bins > 0 {
+		t.BinHz = float64(t.SampleRate) / 2 / float64(hdr.Bins)
+	}
+	// Read onsets in blocks, so a corrupt count
+	// cannot allocate much more than the input.
+	for left := int(hdr.Onsets); left > 0; {
+		n := left
+		if n > 4096 {
+			n = 4096
+		}
+		block := make([]int64, n)
+		if err := binary.Read(br, le, block); err != nil {
+			return nil, err
+		}
+		t.Onsets = append(t.Onsets, block...)
+		left -= n
+	}
+	for i := uint32(0); i < hdr.Frames; i++ {
+		f := AnalysisFrame{Spectrum: make([]float32, hdr.Bins)}
+		if err := binary.Read(br, le, &f.RMS); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(br, le, &f.Bands); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(br, le, f.Spectrum); err != nil {
+			return nil, err
+		}
+		t.Frames = append(t.Frames, f)
+	}
+	return t, nil
+}
+
+// LoadAnalysis loads an analysis track using Load.
+func LoadAnalysis(path string) (*AnalysisTrack, error) {
+	b, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return ReadAnalysisTrack(bytes.NewReader(b))
+}
@@ -0,0 +1,554 @@
+package gfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"strings"
+	"time"
+)
+
+// AnimFrame is a single frame of an animation.
+type AnimFrame struct {
+	// Image is the complete frame, with previous frames composed.
+	// It is *image.Paletted when the animation allows it.
+	Image image.Image
+
+	// Palette of the frame, nil if the frame is not paletted.
+	Palette color.Palette
+
+	// Delay is the time the frame is shown.
+	Delay time.Duration
+
+	// Start is the time the frame is shown, relative to the start of the loop.
+	Start time.Duration
+}
+
+// Animation is a sequence of frames.
+type Animation struct {
+	Frames []AnimFrame
+
+	// Loops is the number of times the animation is played.
+	// 0 means forever.
+	Loops int
+}
+
+// SequenceDelay is the frame delay used by LoadAnimation for image sequences.
+const SequenceDelay = time.Second / 30
+
+// LoadAnimation loads an animation.
+// GIF and APNG files are supported. Other images are loaded as a single frame.
+// If the path contains a formatting verb, like "anim/frame%03d.png",
+// numbered images are loaded as a sequence, starting at 0 or 1,
+// with SequenceDelay between frames.
+func LoadAnimation(path string) (*Animation, error) {
+	if strings.Contains(path, "%") {
+		a, err := LoadImageSequence(path, 0, SequenceDelay)
+		if err != nil && isNotExist(err) {
+			return LoadImageSequence(path, 1, SequenceDelay)
+		}
+		return a, err
+	}
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeAnimation(dat)
+}
+
+// LoadImageSequence loads numbered images as an animation.
+// The number is formatted into pattern using fmt.Sprintf,
+// and images are loaded from first until loading fails.
+func LoadImageSequence(pattern string, first int, delay time.Duration) (*Animation, error) {
+	var a Animation
+	for i := first; ; i++ {
+		dat, err := Load(fmt.Sprintf(pattern, i))
+		if err != nil {
+			if len(a.Frames) == 0 {
+				return nil, err
+			}
+			break
+		}
+		img, _, err := image.Decode(bytes.NewReader(dat))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fmt.Sprintf(pattern, i), err)
+		}
+		f := AnimFrame{Image: img, Delay: delay}
+		if p, ok := img.(*image.Paletted); ok {
+			f.Palette = p.Palette
+		}
+		a.Frames = append(a.Frames, f)
+	}
+	a.setStart()
+	return &a, nil
+}
+
+// DecodeAnimation decodes a GIF or APNG animation.
+// Other images are decoded as a single frame.
+func DecodeAnimation(dat []byte) (*Animation, error) {
+	var a *Animation
+	var err error
+	switch {
+	case bytes.HasPrefix(dat, []byte("GIF8")):
+		a, err = decodeGIFAnim(dat)
+	case bytes.HasPrefix(dat, []byte(pngHeader)):
+		a, err = decodeAPNG(dat)
+	default:
+		var img image.Image
+		img, _, err = image.Decode(bytes.NewReader(dat))
+		if err == nil {
+			a = &Animation{Frames: []AnimFrame{{Image: img}}}
+			if p, ok := img.(*image.Paletted); ok {
+				a.Frames[0].Palette = p.Palette
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.setStart()
+	return a, nil
+}
+
+func (a *Animation) setStart() {
+	var t time.Duration
+	for i := range a.Frames {
+		a.Frames[i].Start = t
+		t += a.Frames[i].Delay
+	}
+}
+
+// Duration returns the duration of a single loop.
+func (a *Animation) Duration() time.Duration {
+	if len(a.Frames) == 0 {
+		return 0
+	}
+	last := a.Frames[len(a.Frames)-1]
+	return last.Start + last.Delay
+}
+
+// Index returns the index of the frame shown at time d.
+// When all loops have been played, the last frame is returned.
+func (a *Animation) Index(d time.Duration) int {
+	total := a.Duration()
+	if len(a.Frames) == 0 {
+		return -1
+	}
+	if total <= 0 || d < 0 {
+		return 0
+	}
+	if a.Loops > 0 && d >= total*time.Duration(a.Loops) {
+		return len(a.Frames) - 1
+	}
+	d %= total
+	// Binary search for the last frame starting before d.
+	lo, hi := 0, len(a.Frames)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if a.Frames[mid].Start <= d {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// At returns the frame shown at time d.
+func (a *Animation) At(d time.Duration) *AnimFrame {
+	i := a.Index(d)
+	if i < 0 {
+		return nil
+	}
+	return &a.Frames[i]
+}
+
+// AtPos returns the frame at position t, where 0 is the start and 1 the end of a single loop.
+// This matches the time given to TimedEffect.
+func (a *Animation) AtPos(t float64) *AnimFrame {
+	return a.At(time.Duration(t * float64(a.Duration())))
+}
+
+// animCanvas composes frames.
+// If pal is set frames are composed as paletted images,
+// otherwise as RGBA.
+type animCanvas struct {
+	pal  *image.Paletted
+	rgba *image.RGBA
+}
+
+func (c *animCanvas) clone() image.Image {
+	if c.pal != nil {
+		dst := image.NewPaletted(c.pal.Rect, c.pal.Palette)
+		copy(dst.Pix, c.pal.Pix)
+		return dst
+	}
+	dst := image.NewRGBA(c.rgba.Rect)
+	copy(dst.Pix, c.rgba.Pix)
+	return dst
+}
+
+func (c *animCanvas) restore(img image.Image) {
+	if c.pal != nil {
+		copy(c.pal.Pix, img.(*image.Paletted).Pix)
+		return
+	}
+	copy(c.rgba.Pix, img.(*image.RGBA).Pix)
+}
+
+// clear r to the background, which is the index bg for paletted canvases
+// and transparent for RGBA.
+func (c *animCanvas) clear(r image.Rectangle, bg uint8) {
+	if c.pal != nil {
+		r = r.Intersect(c.pal.Rect)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			line := c.pal.Pix[c.pal.PixOffset(r.Min.X, y):c.pal.PixOffset(r.Max.X, y)]
+			for x := range line {
+				line[x] = bg
+			}
+		}
+		return
+	}
+	draw.Draw(c.rgba, r, image.Transparent, image.Point{}, draw.Src)
+}
+
+// draw src at its bounds.
+// If over is set, transparent pixels are skipped.
+func (c *animCanvas) draw(src image.Image, over bool) {
+	if c.pal == nil {
+		op := draw.Src
+		if over {
+			op = draw.Over
+		}
+		draw.Draw(c.rgba, src.Bounds(), src, src.Bounds().Min, op)
+		return
+	}
+	s := src.(*image.Paletted)
+	var transparent [256]bool
+	for i, col := range s.Palette {
+		_, _, _, a := col.RGBA()
+		transparent[i] = over && a == 0
+	}
+	r := s.Rect.Intersect(c.pal.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		line := s.Pix[s.PixOffset(r.Min.X, y):s.PixOffset(r.Max.X, y)]
+		dLine := c.pal.Pix[c.pal.PixOffset(r.Min.X, y):c.pal.PixOffset(r.Max.X, y)]
+		for x, v := range line {
+			if !transparent[v] {
+				dLine[x] = v
+			}
+		}
+	}
+}
+
+func samePalette(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		r1, g1, b1, a1 := a[i].RGBA()
+		r2, g2, b2, a2 := b[i].RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeGIFAnim(dat []byte) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, errors.New("gif: no frames")
+	}
+	a := Animation{}
+	switch {
+	case g.LoopCount == 0:
+		a.Loops = 0
+	case g.LoopCount < 0:
+		a.Loops = 1
+	default:
+		a.Loops = g.LoopCount + 1
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Rect
+	}
+	// Compose as paletted, if all frames share a palette.
+	var c animCanvas
+	paletted := true
+	for _, img := range g.Image[1:] {
+		paletted = paletted && samePalette(img.Palette, g.Image[0].Palette)
+	}
+	bg := uint8(g.BackgroundIndex)
+	if paletted {
+		c.pal = image.NewPaletted(bounds, g.Image[0].Palette)
+		// Use the transparent colour as background, if any.
+		if i := TransparentIndex(c.pal.Palette); i >= 0 {
+			bg = uint8(i)
+		}
+		c.clear(bounds, bg)
+	} else {
+		c.rgba = image.NewRGBA(bounds)
+	}
+	for i, img := range g.Image {
+		var prev image.Image
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			prev = c.clone()
+		}
+		c.draw(img, true)
+		delay := 10 * time.Millisecond
+		if i < len(g.Delay) {
+			delay *= time.Duration(g.Delay[i])
+		}
+		// Browsers show very short delays as 100ms.
+		if delay < 20*time.Millisecond {
+			delay = 100 * time.Millisecond
+		}
+		f := AnimFrame{Image: c.clone(), Delay: delay}
+		if c.pal != nil {
+			f.Palette = c.pal.Palette
+		}
+		a.Frames = append(a.Frames, f)
+		switch disposal {
+		case gif.DisposalBackground:
+			c.clear(img.Rect, bg)
+		case gif.DisposalPrevious:
+			c.restore(prev)
+		}
+	}
+	return &a, nil
+}
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readPNGChunks(dat []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(dat, []byte(pngHeader)) {
+		return nil, errors.New("png: invalid header")
+	}
+	dat = dat[len(pngHeader):]
+	var chunks []pngChunk
+	for len(dat) >= 12 {
+		n := binary.BigEndian.Uint32(dat)
+		if uint64(n)+12 > uint64(len(dat)) {
+			return nil, errors.New("png: truncated chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(dat[4:8]), data: dat[8 : 8+n]})
+		dat = dat[12+n:]
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, data ...[]byte) {
+	var n int
+	for _, d := range data {
+		n += len(d)
+	}
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], uint32(n))
+	w.Write(tmp[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	w.WriteString(typ)
+	for _, d := range data {
+		crc.Write(d)
+		w.Write(d)
+	}
+	binary.BigEndian.PutUint32(tmp[:], crc.Sum32())
+	w.Write(tmp[:])
+}
+
+type apngFrameControl struct {
+	Seq                uint32
+	Width, Height      uint32
+	XOffset, YOffset   uint32
+	DelayNum, DelayDen uint16
+	DisposeOp          uint8
+	BlendOp            uint8
+}
+
+const (
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendOver         = 1
+)
+
+func decodeAPNG(dat []byte) (*Animation, error) {
+	chunks, err := readPNGChunks(dat)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ihdr     []byte
+		shared   []pngChunk
+		animated bool
+		loops    int
+		seenIDAT bool
+	)
+	type frame struct {
+		fc   apngFrameControl
+		data [][]byte
+	}
+	var frames []*frame
+	var cur *frame
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			if len(c.data) >= 8 {
+				animated = true
+				loops = int(binary.BigEndian.Uint32(c.data[4:]))
+			}
+		case "fcTL":
+			cur = &frame{}
+			if err := binary.Read(bytes.NewReader(c.data), binary.BigEndian, &cur.fc); err != nil {
+				return nil, err
+			}
+			frames = append(frames, cur)
+		case "IDAT":
+			// The default image is only part of the animation if preceded by fcTL.
+			seenIDAT = true
+			if cur != nil {
+				cur.data = append(cur.data, c.data)
+			}
+		case "fdAT":
+			if cur != nil && len(c.data) >= 4 {
+				cur.data = append(cur.data, c.data[4:])
+			}
+		case "IEND":
+		default:
+			if !seenIDAT {
+				shared = append(shared, c)
+			}
+		}
+	}
+	if len(ihdr) < 13 {
+		return nil, errors.New("png: missing IHDR")
+	}
+	if !animated || len(frames) == 0 {
+		img, err := png.Decode(bytes.NewReader(dat))
+		if err != nil {
+			return nil, err
+		}
+		f := AnimFrame{Image: img}
+		if p, ok := img.(*image.Paletted); ok {
+			f.Palette = p.Palette
+		}
+		return &Animation{Frames: []AnimFrame{f}}, nil
+	}
+
+	a := Animation{Loops: loops}
+	bounds := image.Rect(0, 0, int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:])))
+	const colorTypePaletted = 3
+	var c animCanvas
+	for i, f := range frames {
+		if len(f.data) == 0 {
+			continue
+		}
+		// Create a standalone PNG for the frame.
+		var buf bytes.Buffer
+		buf.WriteString(pngHeader)
+		hdr := append([]byte(nil), ihdr...)
+		binary.BigEndian.PutUint32(hdr[0:], f.fc.Width)
+		binary.BigEndian.PutUint32(hdr[4:], f.fc.Height)
+		writePNGChunk(&buf, "IHDR", hdr)
+		for _, s := range shared {
+			writePNGChunk(&buf, s.typ, s.data)
+		}
+		writePNGChunk(&buf, "IDAT", f.data...)
+		writePNGChunk(&buf, "IEND")
+		img, err := png.Decode(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("apng frame %d: %v", i, err)
+		}
+		r := image.Rect(0, 0, int(f.fc.Width), int(f.fc.Height)).Add(image.Pt(int(f.fc.XOffset), int(f.fc.YOffset)))
+		img = offsetImage(img, r.Min)
+		if c.pal == nil && c.rgba == nil {
+			if p, ok := img.(*image.Paletted); ok && ihdr[9] == colorTypePaletted {
+				c.pal = image.NewPaletted(bounds, p.Palette)
+				// Start with the first transparent colour, like the RGBA canvas.
+				bg := uint8(0)
+				if k := TransparentIndex(p.Palette); k >= 0 {
+					bg = uint8(k)
+				}
+				c.clear(bounds, bg)
+			} else {
+				c.rgba = image.NewRGBA(bounds)
+			}
+		}
+		dispose := f.fc.DisposeOp
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+		var prev image.Image
+		if dispose == apngDisposePrevious {
+			prev = c.clone()
+		}
+		c.draw(img, f.fc.BlendOp == apngBlendOver)
+		den := time.Duration(f.fc.DelayDen)
+		if den == 0 {
+			den = 100
+		}
+		af := AnimFrame{Image: c.clone(), Delay: time.Second * time.Duration(f.fc.DelayNum) / den}
+		if c.pal != nil {
+			af.Palette = c.pal.Palette
+		}
+		a.Frames = append(a.Frames, af)
+		switch dispose {
+		case apngDisposeBackground:
+			bg := uint8(0)
+			if c.pal != nil {
+				if k := TransparentIndex(c.pal.Palette); k >= 0 {
+					bg = uint8(k)
+				}
+			}
+			c.clear(r, bg)
+		case apngDisposePrevious:
+			c.restore(prev)
+		}
+	}
+	if len(a.Frames) == 0 {
+		return nil, errors.New("apng: no frames")
+	}
+	return &a, nil
+}
+
+// offsetImage returns img moved to start at pt.
+func offsetImage(img image.Image, pt image.Point) image.Image {
+	switch i := img.(type) {
+	case *image.Paletted:
+		i.Rect = i.Rect.Add(pt)
+		return i
+	case *image.RGBA:
+		i.Rect = i.Rect.Add(pt)
+		return i
+	case *image.NRGBA:
+		i.Rect = i.Rect.Add(pt)
+		return i
+	case *image.Gray:
+		i.Rect = i.Rect.Add(pt)
+		return i
+	}
+	dst := image.NewRGBA(img.Bounds().Add(pt))
+	draw.Draw(dst, dst.Rect, img, img.Bounds().Min, draw.Src)
+	return dst
+}
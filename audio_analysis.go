@@ -0,0 +1,346 @@
+package gfx
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Frequency bands of AudioAnalysis.Bands.
+const (
+	BandSubBass    = iota // 20 -> 60 Hz
+	BandBass              // 60 -> 250 Hz
+	BandLowMid            // 250 -> 500 Hz
+	BandMid               // 500 -> 2000 Hz
+	BandHighMid           // 2000 -> 4000 Hz
+	BandPresence          // 4000 -> 6000 Hz
+	BandBrilliance        // 6000 -> 20000 Hz
+	NumBands
+)
+
+// bandEdges are the lower frequencies of each band followed by the upper limit.
+var bandEdges = [NumBands + 1]float64{20, 60, 250, 500, 2000, 4000, 6000, 20000}
+
+const (
+	// analysisWindow is the number of samples used for the FFT.
+	analysisWindow = 1024
+	// onsetHop is the number of samples between onset detections.
+	onsetHop = 512
+	// onsetHistory is the number of flux values used for the onset threshold.
+	onsetHistory = 32
+	// onsetMinGap is the minimum time between onsets.
+	onsetMinGap = time.Second / 10
+	// analysisBuffer is the duration of audio kept for analysis.
+	analysisBuffer = 2 * time.Second
+)
+
+// AudioAnalysis is the analysis of the audio at a position.
+type AudioAnalysis struct {
+	// RMS is the level of the window, 0 -> 1.
+	RMS float64
+
+	// Spectrum contains the magnitude of analysisWindow/2 FFT bins from 0Hz to the Nyquist frequency.
+	// A full scale sine will have a magnitude of about 1.
+	Spectrum []float64
+
+	// BinHz is the frequency width of each spectrum bin.
+	BinHz float64
+
+	// Bands contains the energy for each band, see BandBass etc.
+	Bands [NumBands]float64
+
+	// Onset is set if an onset (beat) was detected within the last frame.
+	Onset bool
+
+	// SinceOnset is the time since the last onset, or -1 if there hasn't been any.
+	SinceOnset time.Duration
+}
+
+// Analyzer analyses the audio playing at a position.
+type Analyzer interface {
+	Analyze(pos time.Duration) AudioAnalysis
+}
+
+// analysis is set by UseAnalysis.
+var analysis Analyzer
+
+// UseAnalysis makes Analysis return a, typically a precomputed AnalysisTrack.
+// Use nil to analyse the playing music.
+func UseAnalysis(a Analyzer) {
+	analysis = a
+}
+
+// Analysis returns the analyzer set by UseAnalysis.
+// Otherwise the analyzer of the music started by RunTimedMusic is returned,
+// or nil if the music cannot be analysed.
+// With wasm only modules can be analysed.
+func Analysis() Analyzer {
+	if analysis != nil {
+		return analysis
+	}
+	a, _ := music.(Analyzer)
+	return a
+}
+
+// exportPos is the time of the frame written by RunWriteToDisk, or -1.
+var exportPos time.Duration = -1
+
+// AudioPos returns the music position of the frame being rendered.
+// When writing frames to disk, the time of the frame is returned.
+func AudioPos() time.Duration {
+	if exportPos >= 0 {
+		return exportPos
+	}
+	if music != nil {
+		return music.Pos()
+	}
+	return 0
+}
+
+// CurrentAudio returns the analysis of the audio at AudioPos.
+// If there is no analysis available the zero value is returned.
+func CurrentAudio() AudioAnalysis {
+	a := Analysis()
+	if a == nil {
+		return AudioAnalysis{SinceOnset: -1}
+	}
+	return a.Analyze(AudioPos())
+}
+
+// fft is an in-place radix 2 FFT. len(x) must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wn := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*wn
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wn *= w
+			}
+		}
+	}
+}
+
+// spectrum returns the magnitude spectrum of samples using a Hann window.
+func spectrum(samples []float64) []float64 {
+	n := len(samples)
+	mag := make([]float64, n/2)
+	spectrumTo(mag, make([]complex128, n), samples)
+	return mag
+}
+
+// spectrumTo is spectrum writing to mag, using x for the FFT.
+// x must have the length of samples and mag half of it.
+func spectrumTo(mag []float64, x []complex128, samples []float64) {
+	n := len(samples)
+	for i, v := range samples {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+		x[i] = complex(v*w, 0)
+	}
+	fft(x)
+	for i := range mag {
+		mag[i] = cmplx.Abs(x[i]) * 4 / float64(n)
+	}
+}
+
+// analyzeWindow returns the level, spectrum and band energy of the samples.
+func analyzeWindow(samples []float64, sampleRate int) AudioAnalysis {
+	var res AudioAnalysis
+	var sum float64
+	for _, v := range samples {
+		sum += v * v
+	}
+	res.RMS = math.Sqrt(sum / float64(len(samples)))
+	res.Spectrum = spectrum(samples)
+	res.BinHz = float64(sampleRate) / float64(len(samples))
+	for b := range res.Bands {
+		lo := int(bandEdges[b] / res.BinHz)
+		hi := int(bandEdges[b+1] / res.BinHz)
+		if hi > len(res.Spectrum) {
+			hi = len(res.Spectrum)
+		}
+		if lo >= hi {
+			continue
+		}
+		var e float64
+		for _, m := range res.Spectrum[lo:hi] {
+			e += m * m
+		}
+		res.Bands[b] = e / float64(hi-lo)
+	}
+	return res
+}
+
+// onsetDetector detects onsets using spectral flux with an adaptive threshold.
+type onsetDetector struct {
+	prev    []float64
+	history []float64
+	last    int64
+}
+
+// add the spectrum at sample pos and return whether it is an onset.
+func (o *onsetDetector) add(spec []float64, pos int64, sampleRate int) bool {
+	var flux float64
+	for i, m := range spec {
+		if i < len(o.prev) && m > o.prev[i] {
+			flux += m - o.prev[i]
+		}
+	}
+	o.prev = append(o.prev[:0], spec...)
+	var mean float64
+	for _, v := range o.history {
+		mean += v
+	}
+	full := len(o.history) == onsetHistory
+	if len(o.history) > 0 {
+		mean /= float64(len(o.history))
+	}
+	if full {
+		o.history = o.history[1:]
+	}
+	o.history = append(o.history, flux)
+	minGap := int64(onsetMinGap) * int64(sampleRate) / int64(time.Second)
+	if !full || flux <= mean*1.5+0.01 || (o.last > 0 && pos-o.last < minGap) {
+		return false
+	}
+	o.last = pos
+	return true
+}
+
+// audioAnalyzer analyses audio as it is played.
+// The audio is kept in a ring buffer indexed by sample position.
+type audioAnalyzer struct {
+	sampleRate int
+
+	mu      sync.Mutex
+	ring    []float64
+	written int64
+	pending []float64
+	onsets  []int64
+
+	// detect is held by write while detecting onsets outside mu,
+	// so that Analyze is not blocked by the FFT.
+	detect sync.Mutex
+	onset  onsetDetector
+	window []float64
+	fft    []complex128
+	spec   []float64
+
+	// read returns sample s, if all samples are kept elsewhere.
+	// The ring is not used by Analyze when set.
+	read func(s int64) float64
+}
+
+// newAudioAnalyzer returns an analyzer that keeps size samples.
+func newAudioAnalyzer(sampleRate, size int) *audioAnalyzer {
+	if size < analysisWindow {
+		size = analysisWindow
+	}
+	return &audioAnalyzer{
+		sampleRate: sampleRate,
+		ring:       make([]float64, size),
+		window:     make([]float64, analysisWindow),
+		fft:        make([]complex128, analysisWindow),
+		spec:       make([]float64, analysisWindow/2),
+	}
+}
+
+// write samples as they are played.
+func (a *audioAnalyzer) write(samples [][2]float64) {
+	a.detect.Lock()
+	defer a.detect.Unlock()
+	for len(samples) > 0 {
+		a.mu.Lock()
+		n := 0
+		for ; n < len(samples) && len(a.pending) < analysisWindow; n++ {
+			v := (samples[n][0] + samples[n][1]) / 2
+			a.ring[a.written%int64(len(a.ring))] = v
+			a.written++
+			a.pending = append(a.pending, v)
+		}
+		full := len(a.pending) == analysisWindow
+		pos := a.written - analysisWindow/2
+		if full {
+			copy(a.window, a.pending)
+			a.pending = append(a.pending[:0], a.pending[onsetHop:]...)
+		}
+		a.mu.Unlock()
+		samples = samples[n:]
+
+		if full {
+			spectrumTo(a.spec, a.fft, a.window)
+			if a.onset.add(a.spec, pos, a.sampleRate) {
+				a.mu.Lock()
+				a.onsets = append(a.onsets, pos)
+				a.mu.Unlock()
+			}
+		}
+	}
+}
+
+// seek makes the next samples written start at sample pos.
+// Onsets after pos are detected again.
+func (a *audioAnalyzer) seek(pos int64) {
+	a.detect.Lock()
+	defer a.detect.Unlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range a.ring {
+		a.ring[i] = 0
+	}
+	a.written = pos
+	a.pending = a.pending[:0]
+	a.onset.prev = a.onset.prev[:0]
+	i := sort.Search(len(a.onsets), func(i int) bool { return a.onsets[i] >= pos })
+	a.onsets = a.onsets[:i]
+	a.onset.last = 0
+	if i > 0 {
+		a.onset.last = a.onsets[i-1]
+	}
+}
+
+// Analyze the audio at pos.
+func (a *audioAnalyzer) Analyze(pos time.Duration) AudioAnalysis {
+	end := int64(pos) * int64(a.sampleRate) / int64(time.Second)
+	win := make([]float64, analysisWindow)
+	a.mu.Lock()
+	for i := range win {
+		s := end - analysisWindow + int64(i)
+		// Samples not written or overwritten are silent.
+		if a.read != nil {
+			if s >= 0 {
+				win[i] = a.read(s)
+			}
+		} else if s >= 0 && s < a.written && s >= a.written-int64(len(a.ring)) {
+			win[i] = a.ring[s%int64(len(a.ring))]
+		}
+	}
+	i := sort.Search(len(a.onsets), func(i int) bool { return a.onsets[i] > end })
+	last := int64(-1)
+	if i > 0 {
+		last = a.onsets[i-1]
+	}
+	a.mu.Unlock()
+
+	res := analyzeWindow(win, a.sampleRate)
+	res.SinceOnset = -1
+	if last >= 0 {
+		res.SinceOnset = time.Duration((end - last) * int64(time.Second) / int64(a.sampleRate))
+		res.Onset = res.SinceOnset < time.Second/vSync
+	}
+	return res
+}
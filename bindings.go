@@ -0,0 +1,180 @@
+package gfx
+
+import (
+	"math"
+	"time"
+)
+
+// Action is what a Binding does in the runner.
+type Action int
+
+const (
+	// ActionSeek pauses at the time in Binding.Value, 0 -> 1.
+	ActionSeek Action = iota
+	// ActionPause pauses or resumes.
+	ActionPause
+	// ActionStep pauses and moves the time by Binding.Value every frame the key is held.
+	ActionStep
+	// ActionSpeed multiplies the speed of time by Binding.Value.
+	// A Value of 0 resets the speed.
+	// When music is playing only a SilentPlayer can change speed.
+	ActionSpeed
+	// ActionQuit closes the runner.
+	ActionQuit
+	// ActionMute mutes or unmutes the music.
+	ActionMute
+	// ActionParams shows or hides the parameter panel of a TunableEffect.
+	ActionParams
+	// ActionHUD shows or hides the statistics drawn on the effect.
+	ActionHUD
+	// ActionProfile writes the frame times of the last ProfileHistory to ProfileFile.
+	ActionProfile
+)
+
+// Binding binds a key to an action in the runner.
+// Only the first matching binding of a key is used.
+type Binding struct {
+	Key Key
+
+	// Shift must be held if set.
+	Shift bool
+
+	Action Action
+	Value  float64
+}
+
+// DefaultBindings are the bindings used unless SetBindings is called.
+var DefaultBindings = []Binding{
+	{Key: Key0, Action: ActionSeek, Value: 0},
+	{Key: Key1, Action: ActionSeek, Value: 1.0 / 10},
+	{Key: Key2, Action: ActionSeek, Value: 2.0 / 10},
+	{Key: Key3, Action: ActionSeek, Value: 3.0 / 10},
+	{Key: Key4, Action: ActionSeek, Value: 4.0 / 10},
+	{Key: Key5, Action: ActionSeek, Value: 5.0 / 10},
+	{Key: Key6, Action: ActionSeek, Value: 6.0 / 10},
+	{Key: Key7, Action: ActionSeek, Value: 7.0 / 10},
+	{Key: Key8, Action: ActionSeek, Value: 8.0 / 10},
+	{Key: Key9, Action: ActionSeek, Value: 9.0 / 10},
+	{Key: KeyA, Action: ActionSeek, Value: 999.9 / 1000},
+	{Key: KeyLeft, Shift: true, Action: ActionStep, Value: -1.0 / 10000},
+	{Key: KeyRight, Shift: true, Action: ActionStep, Value: 1.0 / 10000},
+	{Key: KeyLeft, Action: ActionStep, Value: -1.0 / 1000},
+	{Key: KeyRight, Action: ActionStep, Value: 1.0 / 1000},
+	{Key: KeySpace, Action: ActionPause},
+	{Key: KeyMinus, Action: ActionSpeed, Value: 0.5},
+	{Key: KeyEqual, Action: ActionSpeed, Value: 2},
+	{Key: KeyBackspace, Action: ActionSpeed, Value: 0},
+	{Key: KeyM, Action: ActionMute},
+	{Key: KeyTab, Action: ActionParams},
+	{Key: KeyH, Action: ActionHUD},
+	{Key: KeyP, Action: ActionProfile},
+	{Key: KeyEscape, Action: ActionQuit},
+}
+
+var bindings = DefaultBindings
+
+// SetBindings replaces the key bindings of the runners.
+func SetBindings(b []Binding) {
+	bindings = b
+}
+
+// timeline is the effect time of a runner, controlled by the bindings.
+type timeline struct {
+	duration time.Duration
+	last     time.Time
+	live     time.Duration
+	speed    float64
+
+	// fixed is the time while paused.
+	fixed *float64
+	lastT float64
+
+	// showParams is toggled by ActionParams and showHUD by ActionHUD.
+	showParams bool
+	showHUD    bool
+
+	// saveProfile is set by ActionProfile until the runner has written the profile.
+	saveProfile bool
+}
+
+func newTimeline(duration time.Duration) *timeline {
+	return &timeline{duration: duration, last: time.Now(), speed: 1}
+}
+
+// handle applies the bindings to the input of a frame.
+// true is returned if the runner should quit.
+func (tl *timeline) handle(in *Input) (quit bool) {
+	var used [numKeys]bool
+	for _, b := range bindings {
+		active := in.Down(b.Key) || in.JustPressed(b.Key)
+		if !active || b.Shift && !in.Shift() || used[b.Key] {
+			continue
+		}
+		used[b.Key] = true
+		if b.Action == ActionStep {
+			if in.Down(b.Key) {
+				t := tl.lastT + b.Value
+				tl.fixed = &t
+			}
+			continue
+		}
+		if !in.JustPressed(b.Key) {
+			continue
+		}
+		switch b.Action {
+		case ActionSeek:
+			t := b.Value
+			tl.fixed = &t
+		case ActionPause:
+			if tl.fixed != nil {
+				tl.fixed = nil
+				break
+			}
+			t := tl.lastT
+			tl.fixed = &t
+		case ActionSpeed:
+			speed := tl.speed * b.Value
+			if b.Value == 0 {
+				speed = 1
+			}
+			tl.speed = clampF(speed, 1.0/16, 16)
+			if s, ok := music.(interface{ SetSpeed(float64) }); ok {
+				s.SetSpeed(tl.speed)
+			}
+		case ActionMute:
+			SetMusicMuted(!MusicMuted())
+		case ActionParams:
+			tl.showParams = !tl.showParams
+		case ActionHUD:
+			tl.showHUD = !tl.showHUD
+		case ActionProfile:
+			tl.saveProfile = true
+		case ActionQuit:
+			quit = true
+		}
+	}
+	return quit
+}
+
+// next returns the time of the next frame, 0 -> 1.
+// If music is playing the music position is used,
+// so the effect follows loops in the music.
+func (tl *timeline) next() float64 {
+	now := time.Now()
+	if music != nil {
+		tl.live = music.Pos()
+	} else {
+		tl.live += time.Duration(float64(now.Sub(tl.last)) * tl.speed)
+	}
+	tl.last = now
+	t := float64(tl.live) / float64(tl.duration)
+	if tl.fixed != nil {
+		t = *tl.fixed
+	}
+	_, t = math.Modf(t)
+	if t < 0 {
+		t++
+	}
+	tl.lastT = t
+	return t
+}
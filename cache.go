@@ -0,0 +1,268 @@
+package gfx
+
+import (
+	"hash/crc32"
+	"image"
+	"image/color"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reloadable effects are notified when assets in DefaultCache
+// have been reloaded while running with hot reload enabled.
+// Reload is called before Render with the paths that changed.
+type Reloadable interface {
+	Reload(paths []string)
+}
+
+// Asset is a handle to a decoded asset in a Cache.
+// The content is replaced when the source file changes,
+// so effects should keep the handle and not the value
+// if they want to see updates.
+type Asset struct {
+	path   string
+	decode func([]byte) (interface{}, error)
+
+	mu      sync.RWMutex
+	v       interface{}
+	crc     uint32
+	size    int
+	version int
+}
+
+// Path returns the path the asset was loaded from.
+func (a *Asset) Path() string {
+	return a.path
+}
+
+// Version returns the version of the asset.
+// It is increased every time the asset is reloaded.
+func (a *Asset) Version() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.version
+}
+
+// Value returns the current decoded value.
+func (a *Asset) Value() interface{} {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.v
+}
+
+// Image returns the asset as an image or nil if it isn't an image.
+func (a *Asset) Image() image.Image {
+	img, _ := a.Value().(image.Image)
+	return img
+}
+
+// Gray returns the asset as a grey image or nil if it isn't one.
+func (a *Asset) Gray() *image.Gray {
+	img, _ := a.Value().(*image.Gray)
+	return img
+}
+
+// Paletted returns the asset as a paletted image or nil if it isn't one.
+func (a *Asset) Paletted() *image.Paletted {
+	img, _ := a.Value().(*image.Paletted)
+	return img
+}
+
+// Data returns the asset as raw data or nil if it isn't.
+func (a *Asset) Data() []byte {
+	b, _ := a.Value().([]byte)
+	return b
+}
+
+// Animation returns the asset as an animation or nil if it isn't one.
+func (a *Asset) Animation() *Animation {
+	anim, _ := a.Value().(*Animation)
+	return anim
+}
+
+// Palette returns the asset as a palette or nil if it isn't one.
+func (a *Asset) Palette() color.Palette {
+	p, _ := a.Value().(color.Palette)
+	return p
+}
+
+// update the asset if the data has changed.
+// Returns true if the asset was changed.
+func (a *Asset) update(b []byte) (bool, error) {
+	crc := crc32.ChecksumIEEE(b)
+	a.mu.RLock()
+	same := a.version > 0 && crc == a.crc && len(b) == a.size
+	a.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+	v, err := a.decode(b)
+	if err != nil {
+		return false, err
+	}
+	a.mu.Lock()
+	a.v, a.crc, a.size = v, crc, len(b)
+	a.version++
+	a.mu.Unlock()
+	return true, nil
+}
+
+// Cache will memoize decoded assets.
+type Cache struct {
+	// Loader used for loading files.
+	// If nil, DefaultLoader is used.
+	Loader *Loader
+
+	mu      sync.Mutex
+	assets  map[string]*Asset
+	changed map[string]struct{}
+}
+
+// DefaultCache is the cache that is polled for changes when hot reload is enabled.
+var DefaultCache = &Cache{}
+
+func (c *Cache) load(path string) ([]byte, error) {
+	if c.Loader != nil {
+		return c.Loader.Load(path)
+	}
+	return Load(path)
+}
+
+// get returns the asset of the given kind,
+// loading it if is not in the cache.
+func (c *Cache) get(kind, path string, decode func([]byte) (interface{}, error)) (*Asset, error) {
+	key := kind + ":" + path
+	c.mu.Lock()
+	a, ok := c.assets[key]
+	c.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+	b, err := c.load(path)
+	if err != nil {
+		return nil, err
+	}
+	a = &Asset{path: path, decode: decode}
+	if _, err := a.update(b); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another caller may have added it meanwhile.
+	if existing, ok := c.assets[key]; ok {
+		return existing, nil
+	}
+	if c.assets == nil {
+		c.assets = make(map[string]*Asset)
+	}
+	c.assets[key] = a
+	return a, nil
+}
+
+// GreyPicture returns a grey picture as loaded by LoadGreyPicture.
+func (c *Cache) GreyPicture(path string) (*Asset, error) {
+	return c.get("grey", path, func(b []byte) (interface{}, error) {
+		return decodeGreyPicture(b)
+	})
+}
+
+// PalPicture returns a paletted picture as loaded by LoadPalPicture.
+func (c *Cache) PalPicture(path string) (*Asset, error) {
+	return c.get("pal", path, func(b []byte) (interface{}, error) {
+		return decodePalPicture(b, Quantize{})
+	})
+}
+
+// Palette returns a palette as loaded by LoadPalette.
+func (c *Cache) Palette(path string) (*Asset, error) {
+	return c.get("palette", path, func(b []byte) (interface{}, error) {
+		return decodePalette(b)
+	})
+}
+
+// Data returns the raw content of a file.
+func (c *Cache) Data(path string) (*Asset, error) {
+	return c.get("data", path, func(b []byte) (interface{}, error) {
+		return b, nil
+	})
+}
+
+// Animation returns an animation as loaded by LoadAnimation.
+// Image sequences are not supported.
+func (c *Cache) Animation(path string) (*Asset, error) {
+	return c.get("anim", path, func(b []byte) (interface{}, error) {
+		return DecodeAnimation(b)
+	})
+}
+
+// Poll will reload all assets and update the ones that have changed.
+// The paths of the changed assets are returned.
+// Files that fail to load or decode keep their current value.
+func (c *Cache) Poll() []string {
+	c.mu.Lock()
+	assets := make([]*Asset, 0, len(c.assets))
+	for _, a := range c.assets {
+		assets = append(assets, a)
+	}
+	c.mu.Unlock()
+
+	var changed []string
+	for _, a := range assets {
+		b, err := c.load(a.path)
+		if err != nil {
+			continue
+		}
+		if ok, err := a.update(b); ok && err == nil {
+			changed = append(changed, a.path)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	c.mu.Lock()
+	if c.changed == nil {
+		c.changed = make(map[string]struct{})
+	}
+	for _, p := range changed {
+		c.changed[p] = struct{}{}
+	}
+	c.mu.Unlock()
+	return changed
+}
+
+// Changed returns the paths that have changed since the last call.
+func (c *Cache) Changed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.changed) == 0 {
+		return nil
+	}
+	res := make([]string, 0, len(c.changed))
+	for p := range c.changed {
+		res = append(res, p)
+	}
+	c.changed = nil
+	sort.Strings(res)
+	return res
+}
+
+// Watch will poll the cache at the given interval until stop is called.
+func (c *Cache) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				c.Poll()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,86 @@
+// +build !wasm
+
+package gfx
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"time"
+
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// RunCalibration plays a click on every beat at the given BPM and flashes the window at the same time.
+// Use left and right to change the audio latency until clicks and flashes line up.
+// Hold shift for small steps.
+// Press enter to save the latency to ConfigFile, where it is read when music starts.
+// Press escape to exit.
+func RunCalibration(bpm float64) {
+	applyConfig()
+	beat := float64(renderSampleRate) * 60 / bpm
+	clicks := &renderedMusic{}
+	clicks.restart = func() func(buf [][2]float64) int {
+		var pos int64
+		return func(buf [][2]float64) int {
+			for i := range buf {
+				n := float64(pos + int64(i))
+				ph := math.Mod(n, beat)
+				// Accent the first beat of each bar.
+				freq := 1000.0
+				if int(n/beat)%4 == 0 {
+					freq = 1500
+				}
+				t := ph / renderSampleRate
+				v := 0.8 * math.Sin(2*math.Pi*freq*t) * math.Exp(-t/0.005)
+				buf[i] = [2]float64{v, v}
+			}
+			pos += int64(len(buf))
+			return len(buf)
+		}
+	}
+	clicks.render = clicks.restart()
+	if err := clicks.open(); err != nil {
+		panic(err)
+	}
+	win := openWindow()
+	clicks.Start(func(time.Duration) {})
+	flash := time.Duration(float64(time.Minute) / bpm / 8)
+	beatDur := time.Duration(float64(time.Minute) / bpm)
+	for !win.Closed() {
+		if win.JustPressed(pixelgl.KeyEscape) {
+			win.SetClosed(true)
+			continue
+		}
+		step := 5 * time.Millisecond
+		if win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift) {
+			step = time.Millisecond
+		}
+		switch {
+		case win.JustPressed(pixelgl.KeyLeft):
+			SetAudioLatency(AudioLatency() - step)
+		case win.JustPressed(pixelgl.KeyRight):
+			SetAudioLatency(AudioLatency() + step)
+		case win.JustPressed(pixelgl.KeyEnter):
+			c, err := loadConfig()
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Println("Reading config:", err)
+			}
+			c.AudioLatencyMS = float64(AudioLatency()) / float64(time.Millisecond)
+			if err := saveConfig(c); err != nil {
+				fmt.Println("Saving config:", err)
+			} else {
+				fmt.Println("Saved audio latency to", ConfigFile)
+			}
+		}
+		p := clicks.Pos()
+		if p >= 0 && p%beatDur < flash {
+			win.Clear(color.White)
+		} else {
+			win.Clear(color.Black)
+		}
+		win.SetTitle(fmt.Sprintf("%s | latency: %v | left/right: adjust, enter: save", windowTitle, AudioLatency()))
+		win.Update()
+	}
+}
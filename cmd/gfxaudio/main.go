@@ -0,0 +1,58 @@
+// gfxaudio precomputes audio analysis for each frame of a music file.
+//
+// Usage:
+//
+//	gfxaudio [-o music.ana] [-fps 60] [-bins 64] music.mp3
+//
+// The output can be loaded with gfx.LoadAnalysis and used with gfx.UseAnalysis,
+// so audio reactive effects give the same result in the preview and when written to disk.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/gfx"
+)
+
+var (
+	out  = flag.String("o", "", "Output file. Default is the input with .ana extension")
+	fps  = flag.Float64("fps", 60, "Frames per second")
+	bins = flag.Int("bins", 64, "Spectrum bins per frame. 0 keeps the full spectrum")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gfxaudio [options] music")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *fps <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	in := flag.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(in, filepath.Ext(in)) + ".ana"
+	}
+	t, err := gfx.AnalyzeMusic(in, *fps, *bins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n, err := t.WriteTo(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %d frames and %d onsets to %s: %d bytes\n", len(t.Frames), len(t.Onsets), *out, n)
+}
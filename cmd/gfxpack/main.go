@@ -0,0 +1,101 @@
+// gfxpack builds a pack file from a directory.
+//
+// Usage:
+//
+//	gfxpack [-o demo.pak] [-c zstd] [-key secret] dir
+//
+// Files are stored with paths relative to dir using forward slashes,
+// so "dir/data/click.png" can be loaded as "data/click.png".
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/gfx/pack"
+)
+
+var (
+	out    = flag.String("o", "data.pak", "Output file")
+	method = flag.String("c", "zstd", "Compression: store, deflate or zstd")
+	key    = flag.String("key", "", "Obfuscate content with this key")
+	quiet  = flag.Bool("q", false, "Don't print added files")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gfxpack [options] dir")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var m pack.Method
+	switch *method {
+	case "store":
+		m = pack.Store
+	case "deflate":
+		m = pack.Deflate
+	case "zstd":
+		m = pack.Zstd
+	default:
+		log.Fatalf("unknown compression %q", *method)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w, err := pack.NewWriter(f, []byte(*key))
+	if err != nil {
+		log.Fatal(err)
+	}
+	root := flag.Arg(0)
+	outAbs, _ := filepath.Abs(*out)
+	var files, in, written int64
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// Don't include the output in itself.
+		if abs, _ := filepath.Abs(p); abs == outAbs {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		before := w.Size()
+		used, err := w.Add(filepath.ToSlash(rel), b, m)
+		if err != nil {
+			return err
+		}
+		files++
+		in += int64(len(b))
+		written += w.Size() - before
+		if !*quiet {
+			fmt.Printf("%s: %d -> %d (%v)\n", filepath.ToSlash(rel), len(b), w.Size()-before, used)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %d files to %s: %d -> %d bytes\n", files, *out, in, written)
+}
@@ -0,0 +1,70 @@
+// +build !wasm
+
+package gfx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConfigFile is the file settings found by RunCalibration are stored in.
+var ConfigFile = "gfx.json"
+
+// config is the content of ConfigFile.
+type config struct {
+	// AudioLatencyMS is the audio latency in milliseconds.
+	AudioLatencyMS float64 `json:"audio_latency_ms"`
+}
+
+func loadConfig() (config, error) {
+	var c config
+	b, err := ioutil.ReadFile(ConfigFile)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+func saveConfig(c config) error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ConfigFile, b, 0644)
+}
+
+var configOnce sync.Once
+
+// applyConfig applies the settings in ConfigFile the first time it is called.
+// Settings made by the program take precedence.
+func applyConfig() {
+	configOnce.Do(func() {
+		c, err := loadConfig()
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Println("Reading config:", err)
+			}
+			return
+		}
+		musicCtl.mu.Lock()
+		if !musicCtl.latencySet {
+			musicCtl.latency = time.Duration(c.AudioLatencyMS * float64(time.Millisecond))
+		}
+		musicCtl.mu.Unlock()
+	})
+}
+
+// saveFile writes output of the runner, like presets, to a file.
+func saveFile(name string, b []byte) error {
+	return ioutil.WriteFile(name, b, 0644)
+}
+
+// savedText describes where saveFile put name.
+func savedText(name string) string {
+	return "Saved " + name
+}
@@ -22,28 +22,71 @@ func Run(fn func()) {
 	pixelgl.Run(fn)
 }
 
-func RunTimedDur(effect TimedEffect, duration time.Duration) {
+const windowTitle = "Effect"
+
+// window is shared by preloading and the runner.
+var window *pixelgl.Window
+
+// openWindow returns the window, creating it on first use.
+func openWindow() *pixelgl.Window {
+	if window != nil {
+		return window
+	}
 	cfg := pixelgl.WindowConfig{
-		Title:  "Effect",
+		Title:  windowTitle,
 		Bounds: pixel.R(0, 0, fRenderWidth*scale, fRenderHeight*scale),
 		VSync:  true,
 	}
 	if fullscreen {
 		cfg.Monitor = pixelgl.PrimaryMonitor()
 	}
-	var (
-		frames = 0
-		vfps   time.Duration
-		update = time.Tick(time.Second / 2)
-		lastT  = time.Now()
-	)
-
 	win, err := pixelgl.NewWindow(cfg)
 	if err != nil {
 		panic(err)
 	}
+	window = win
+	return win
+}
+
+// waitPreload loads the preload manifest while showing progress in the window.
+func waitPreload() {
+	progress, err := startPreload()
+	if progress == nil {
+		return
+	}
+	win := openWindow()
+	c := win.Bounds().Center()
+	dst := pixel.MakePictureData(pixel.R(0, 0, fRenderWidth, fRenderHeight))
+	var p [2]int
+	for {
+		select {
+		case v, ok := <-progress:
+			if !ok {
+				if *err != nil {
+					panic(*err)
+				}
+				return
+			}
+			p = v
+		default:
+		}
+		if win.Closed() {
+			// Wait for loading to finish.
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		copyTo(dst, progressImage(p[0], p[1]))
+		pixel.NewSprite(dst, dst.Bounds()).
+			Draw(win, pixel.IM.Moved(c).Scaled(c, scale))
+		win.Update()
+	}
+}
+
+func RunTimedDur(effect TimedEffect, duration time.Duration) {
+	waitPreload()
+	win := openWindow()
+	defer startHotReload()()
 	c := win.Bounds().Center()
-	started := time.Now()
 	bar := pixel.MakePictureData(pixel.R(0, 0, 4, fRenderHeight*scale))
 	barRed := pixel.MakePictureData(pixel.R(0, 0, 4, fRenderHeight*scale))
 	for i := range bar.Pix {
@@ -53,26 +96,33 @@ func RunTimedDur(effect TimedEffect, duration time.Duration) {
 		barRed.Pix[i].A = 192
 	}
 	dst := pixel.MakePictureData(pixel.R(0, 0, fRenderWidth, fRenderHeight))
-	var fixedT *float64
+	tl := newTimeline(duration)
+	params := effectParams(effect)
+	var panel *paramPanel
+	if params != nil {
+		panel = newParamPanel(params)
+	}
 	var lastRenderT float64
+	stats := newFrameStats()
 	for !win.Closed() {
-		if win.JustPressed(pixelgl.KeyEscape) {
+		in := pollInput(win)
+		if panel != nil && tl.showParams {
+			panel.handle(&in)
+		}
+		if tl.handle(&in) {
 			win.SetClosed(true)
 			continue
 		}
 		startFrame := time.Now()
 		x, _ := QueryPerformanceCounter()
-		t := float64(startFrame.Sub(started)) / float64(duration)
-		fixedT = updateInput(win, fixedT, lastRenderT)
-		if fixedT != nil {
-			t = *fixedT
-		}
-		_, t = math.Modf(t)
-		if t < 0 {
-			t = 1 - t
-		}
+		t := tl.next()
 		lastRenderT = t
+		reloadAssets(effect)
+		sendInput(effect, in)
+		sendParams(effect, params)
+		beginSections()
 		pic := effect.Render(t)
+		sections := endSections()
 		spent := time.Now().Sub(startFrame)
 		y, err := QueryPerformanceCounter()
 		if err == nil {
@@ -81,11 +131,23 @@ func RunTimedDur(effect TimedEffect, duration time.Duration) {
 				spent = (time.Duration(y-x) * time.Second) / time.Duration(f)
 			}
 		}
-		vfps += spent
 		elapsed := float64(spent) / float64(time.Second/vSync)
 		elapsed = math.Min(elapsed, 1)
+		if stats.add(t, spent, sections) {
+			win.SetTitle(windowTitle + " | " + stats.status(lastRenderT))
+		}
+		if tl.saveProfile {
+			saveProfile(stats)
+			tl.saveProfile = false
+		}
 
 		copyTo(dst, pic)
+		if panel != nil && tl.showParams {
+			panel.draw(pictureView(dst))
+		}
+		if tl.showHUD {
+			drawHUD(pictureView(dst), stats, lastRenderT)
+		}
 		pixel.NewSprite(dst, dst.Bounds()).
 			Draw(win, pixel.IM.Moved(c).Scaled(c, scale))
 
@@ -100,24 +162,28 @@ func RunTimedDur(effect TimedEffect, duration time.Duration) {
 				Draw(win, pixel.IM.Moved(pixel.Vec{2, tl}))
 		}
 		win.Update()
-		frames++
-		select {
-		case <-update:
-			elapsed := time.Since(lastT)
-			virtual := time.Duration(frames) * elapsed / vfps
-			virtual = virtual * time.Second / elapsed
-			rframes := float64(frames) * float64(time.Second) / float64(elapsed)
-			win.SetTitle(fmt.Sprintf("%s | time: %0.3f | FPS: %.0f | vFPS: %d", cfg.Title, lastRenderT, rframes, virtual))
-			frames = 0
-			vfps = 0
-			lastT = time.Now()
-		default:
-		}
 	}
 }
 
+// diskLoopFrames is the number of frames RunWriteToDisk writes per loop.
+const diskLoopFrames = 10 * vSync
+
+// RunWriteToDiskMusic writes frames like RunWriteToDisk.
+// The music is decoded, trimmed to the length of the frames
+// and written as a WAV file next to the frames.
+// With a path of "out/frame%05d.png" the music is written to "out/frame.wav".
+func RunWriteToDiskMusic(fx TimedEffect, n int, path, musicFile string) {
+	dst := musicExportPath(path)
+	err := writeMusicWAV(musicFile, dst, time.Duration(n*diskLoopFrames)*time.Second/vSync)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Wrote music to", dst)
+	RunWriteToDisk(fx, n, path)
+}
+
 func RunWriteToDisk(fx TimedEffect, n int, path string) {
-	const length = 10 * vSync
+	const length = diskLoopFrames
 	frame := 0
 	type toSave struct {
 		img image.Image
@@ -148,8 +214,12 @@ func RunWriteToDisk(fx TimedEffect, n int, path string) {
 			}
 		}()
 	}
+	defer func() { exportPos = -1 }()
+	params := effectParams(fx)
 	for i := 0; i < n; i++ {
 		for j := 0; j < length; j++ {
+			exportPos = time.Duration(frame) * time.Second / vSync
+			sendParams(fx, params)
 			img := fx.Render(float64(j) / length)
 			switch i := img.(type) {
 			case *image.Gray:
@@ -182,51 +252,20 @@ func RunWriteToDisk(fx TimedEffect, n int, path string) {
 	wg.Wait()
 }
 
-func updateInput(win *pixelgl.Window, t *float64, lastT float64) *float64 {
-	var fP = func(f float64) *float64 { return &f }
-	switch {
-	case win.JustPressed(pixelgl.Key0):
-		return fP(0)
-	case win.JustPressed(pixelgl.Key1):
-		return fP(1.0 / 10)
-	case win.JustPressed(pixelgl.Key2):
-		return fP(2.0 / 10)
-	case win.JustPressed(pixelgl.Key3):
-		return fP(3.0 / 10)
-	case win.JustPressed(pixelgl.Key4):
-		return fP(4.0 / 10)
-	case win.JustPressed(pixelgl.Key5):
-		return fP(5.0 / 10)
-	case win.JustPressed(pixelgl.Key6):
-		return fP(6.0 / 10)
-	case win.JustPressed(pixelgl.Key7):
-		return fP(7.0 / 10)
-	case win.JustPressed(pixelgl.Key8):
-		return fP(8.0 / 10)
-	case win.JustPressed(pixelgl.Key9):
-		return fP(9.0 / 10)
-	case win.JustPressed(pixelgl.KeyA):
-		return fP(999.9 / 1000)
-	case win.Pressed(pixelgl.KeyLeft):
-		d := 1.0 / 1000
-		if win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift) {
-			d *= 0.1
-		}
-		return fP(lastT - d)
-	case win.Pressed(pixelgl.KeyRight):
-		d := 1.0 / 1000
-		if win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift) {
-			d *= 0.1
-		}
-		return fP(lastT + d)
-	case win.JustPressed(pixelgl.KeySpace):
-		if t == nil {
-			return &lastT
-		}
-		return nil
+// pictureView returns dst as a draw.Image with 0,0 at the top left.
+func pictureView(dst *pixel.PictureData) *frameView {
+	h := len(dst.Pix) / dst.Stride
+	return &frameView{
+		rect: image.Rect(0, 0, dst.Stride, h),
+		get: func(x, y int) color.RGBA {
+			return dst.Pix[(h-1-y)*dst.Stride+x]
+		},
+		put: func(x, y int, c color.RGBA) {
+			dst.Pix[(h-1-y)*dst.Stride+x] = c
+		},
 	}
-	return t
 }
+
 func copyTo(dst *pixel.PictureData, src image.Image) {
 	switch s := src.(type) {
 	case *image.Paletted:
@@ -309,23 +348,8 @@ func copyGrayToPaletted(src *image.Gray) *image.Paletted {
 // copyToGen, allocates... Implement faster ones...
 func copyToGen(dst *pixel.PictureData, src image.Image) {
 	rgba := image.NewRGBA(src.Bounds())
-	draw.Draw(rgba, rgba.Bounds(), src, image.Pt(0, 0), draw.Src)
-
-	for y := 0; y < rgba.Rect.Dy(); y++ {
-		line := rgba.Pix[y*rgba.Stride : y*rgba.Stride+rgba.Rect.Dx()]
-		// Destination is flipped.
-		dstY := rgba.Rect.Dy() - y - 1
-		dLine := dst.Pix[dstY*dst.Stride : dstY*dst.Stride+len(line)]
-		for x := range dLine {
-			dLine[x] =
-				color.RGBA{
-					R: uint8(line[x*4] >> 8),
-					G: uint8(line[x*4+1] >> 8),
-					B: uint8(line[x*4+2] >> 8),
-					A: uint8(line[x*4+3] >> 8),
-				}
-		}
-	}
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+	copyToRGBA(dst, rgba)
 }
 
 func copyToRGBA(dst *pixel.PictureData, src *image.RGBA) {
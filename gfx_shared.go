@@ -1,6 +1,8 @@
 package gfx
 
 import (
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -13,6 +15,7 @@ var (
 	fRenderWidth  = 640.0
 	fRenderHeight = 360.0
 	fullscreen    = false
+	hotReload     time.Duration
 )
 
 func SetRenderSize(w, h int) {
@@ -24,6 +27,32 @@ func Fullscreen(b bool) {
 	fullscreen = b
 }
 
+// HotReload will make the runners poll DefaultCache for changed files
+// with the given interval. Use 0 to disable.
+func HotReload(interval time.Duration) {
+	hotReload = interval
+}
+
+// startHotReload starts watching DefaultCache, if enabled.
+func startHotReload() (stop func()) {
+	if hotReload <= 0 {
+		return func() {}
+	}
+	return DefaultCache.Watch(hotReload)
+}
+
+// reloadAssets will notify the effect if assets have changed.
+func reloadAssets(effect interface{}) {
+	if hotReload <= 0 {
+		return
+	}
+	if paths := DefaultCache.Changed(); len(paths) > 0 {
+		if r, ok := effect.(Reloadable); ok {
+			r.Reload(paths)
+		}
+	}
+}
+
 const (
 	scale = 2.0
 	vSync = 60
@@ -33,16 +62,82 @@ func RunTimed(effect TimedEffect) {
 	RunTimedDur(effect, 10*time.Second)
 }
 
+// audioInitError is returned when audio output cannot be initialized.
+type audioInitError struct {
+	err error
+}
+
+func (e *audioInitError) Error() string {
+	return "audio init: " + e.err.Error()
+}
+
+func (e *audioInitError) Unwrap() error {
+	return e.err
+}
+
+// silentOnNoAudio returns a SilentPlayer if err is caused by missing audio output.
+// Other errors are returned.
+func silentOnNoAudio(err error) (MusicPlayer, error) {
+	var noAudio *audioInitError
+	if !errors.As(err, &noAudio) {
+		return nil, err
+	}
+	fmt.Println(err, "- playing without sound")
+	return NewSilentPlayer(), nil
+}
+
+// music is the music started by RunTimedMusic.
+var music MusicPlayer
+
+// Music returns the music player started by RunTimedMusic, or nil.
+// Modules are played by a *ModulePlayer, which gives access to the pattern data.
+func Music() MusicPlayer {
+	return music
+}
+
 func RunTimedMusic(effect TimedEffect, musicFile string) {
+	// Load everything before the music starts.
+	waitPreload()
+	if silentMusic {
+		RunTimedMusicPlayer(effect, NewSilentPlayer())
+		return
+	}
 	sfx, err := loadMusic(musicFile)
+	if err != nil {
+		sfx, err = silentOnNoAudio(err)
+	}
 	if err != nil {
 		panic(err)
 	}
-	sfx.Start(func(duration time.Duration) {
+	RunTimedMusicPlayer(effect, sfx)
+}
+
+// RunTimedMusicPlayer runs the effect while playing music from a player,
+// for example a SynthPlayer with a song described in Go.
+// Audio output for modules and synth songs is opened here.
+// If no audio device is available, a SilentPlayer is used instead,
+// so effects can run without sound, for example in CI.
+func RunTimedMusicPlayer(effect TimedEffect, m MusicPlayer) {
+	waitPreload()
+	if o, ok := m.(interface{ open() error }); ok {
+		if err := o.open(); err != nil {
+			sp, err := silentOnNoAudio(err)
+			if err != nil {
+				panic(err)
+			}
+			m = sp
+		}
+	}
+	music = m
+	// Players streamed by the mixer replace this when started.
+	followMusic(m.Pos)
+	m.Start(func(duration time.Duration) {
 		RunTimed(effect)
 	})
 }
 
+// ToGray converts img to grey using Rec601 luma.
+// Use ToGrayOpt for other conversions.
 func ToGray(img image.Image) *image.Gray {
 	grey := image.NewGray(img.Bounds())
 	draw.Draw(grey, grey.Rect, img, image.Pt(0, 0), draw.Src)
@@ -5,6 +5,7 @@ package gfx
 import (
 	"fmt"
 	"image"
+	"image/draw"
 	"log"
 	"math"
 	"runtime/debug"
@@ -58,13 +59,39 @@ func Run(fn func()) {
 	select {}
 }
 
+// waitPreload loads the preload manifest while showing progress
+// in the status element and on the canvas.
+func waitPreload() {
+	progress, err := startPreload()
+	if progress == nil {
+		return
+	}
+	canvas := getElementById("fx-display")
+	ctx := canvas.Call("getContext", "2d")
+	canvasData := ctx.Call("createImageData", renderWidth, renderHeight)
+	data := canvasData.Get("data")
+	screen32 := make([]byte, renderWidth*renderHeight*4)
+	for p := range progress {
+		setStatus(fmt.Sprintf("Loading... %d/%d", p[0], p[1]))
+		copyToRGBA(screen32, progressImage(p[0], p[1]))
+		arr := js.TypedArrayOf(screen32)
+		data.Call("set", arr)
+		arr.Release()
+		ctx.Call("putImageData", canvasData, 0, 0)
+	}
+	if *err != nil {
+		panic(*err)
+	}
+}
+
 func Wait() {
+	status = getElementById("status")
+	setStatus("Initializing...")
+	waitPreload()
 	pic, err := LoadGreyPicture("data/click.png")
 	if err != nil {
 		panic(err)
 	}
-	status = getElementById("status")
-	setStatus("Initializing...")
 	canvas := getElementById("fx-display")
 	ctx := canvas.Call("getContext", "2d")
 	canvasData := ctx.Call("createImageData", renderWidth, renderHeight)
@@ -88,21 +115,25 @@ func Wait() {
 }
 
 func RunTimedDur(fx TimedEffect, duration time.Duration) {
+	waitPreload()
 	canvas := getElementById("fx-display")
 	ctx := canvas.Call("getContext", "2d")
 	canvasData := ctx.Call("createImageData", renderWidth, renderHeight)
 	data := canvasData.Get("data")
 
 	screen32 := make([]byte, renderWidth*renderHeight*4)
-	const printInterval = vSync
+	startHotReload()
 	var (
-		fixedT      *float64
+		tl          = newTimeline(duration)
 		lastRenderT float64
-		vfps        time.Duration
-		lastT       = time.Now()
-		started     = time.Now()
-		frames      int
+		stats       = newFrameStats()
 	)
+	listenInput(canvas)
+	params := effectParams(fx)
+	var panel *paramPanel
+	if params != nil {
+		panel = newParamPanel(params)
+	}
 
 	var draw func(args []jsObject)
 	draw = func(args []jsObject) {
@@ -112,20 +143,27 @@ func RunTimedDur(fx TimedEffect, duration time.Duration) {
 				debug.PrintStack()
 			}
 		}()
-		startFrame := time.Now()
-		t := float64(startFrame.Sub(started)) / float64(duration)
-		fixedT = updateInput(fixedT, lastRenderT)
-		if fixedT != nil {
-			t = *fixedT
+		var read [numKeys]bool
+		in := keys.frame()
+		in.read = &read
+		if panel != nil && tl.showParams {
+			panel.handle(&in)
 		}
-		_, t = math.Modf(t)
-		if t < 0 {
-			t = 1 - t
+		if tl.handle(&in) {
+			setStatus("Stopped")
+			return
 		}
+		startFrame := time.Now()
+		t := tl.next()
 		lastRenderT = t
+		reloadAssets(fx)
+		sendInput(fx, in)
+		usedKeys(&read)
+		sendParams(fx, params)
+		beginSections()
 		screen := fx.Render(t)
+		sections := endSections()
 		spent := time.Now().Sub(startFrame)
-		vfps += spent
 		elapsed := float64(spent) / float64(time.Second/vSync)
 		elapsed = math.Min(elapsed, 1)
 		switch scr := screen.(type) {
@@ -136,7 +174,20 @@ func RunTimedDur(fx TimedEffect, duration time.Duration) {
 		case *image.RGBA:
 			copyToRGBA(screen32, scr)
 		default:
-			panic(fmt.Sprintf("Unhandled screen type: %T", screen))
+			copyToGen(screen32, screen)
+		}
+		if panel != nil && tl.showParams {
+			panel.draw(rgbaView(screen32, renderWidth, renderHeight))
+		}
+		if stats.add(t, spent, sections) {
+			setStatus("FX | " + stats.status(lastRenderT))
+		}
+		if tl.saveProfile {
+			saveProfile(stats)
+			tl.saveProfile = false
+		}
+		if tl.showHUD {
+			drawHUD(rgbaView(screen32, renderWidth, renderHeight), stats, lastRenderT)
 		}
 		if elapsed < 1 {
 			h := int(elapsed * float64(renderHeight))
@@ -163,19 +214,6 @@ func RunTimedDur(fx TimedEffect, duration time.Duration) {
 
 		data.Call("set", js.TypedArrayOf(screen32))
 		ctx.Call("putImageData", canvasData, 0, 0)
-
-		frames++
-		if frames >= printInterval {
-			elapsed := time.Since(lastT)
-			virtual := time.Duration(frames) * elapsed / vfps
-			virtual = virtual * time.Second / elapsed
-			rframes := float64(frames) * float64(time.Second) / float64(elapsed)
-			setStatus(fmt.Sprintf("%s | time: %0.3f | FPS: %.0f | vFPS: %d", "FX", lastRenderT, rframes, virtual))
-
-			frames = 0
-			vfps = 0
-			lastT = time.Now()
-		}
 		Global.Call("requestAnimationFrame", newCallback(draw))
 	}
 	Global.Call("requestAnimationFrame", newCallback(draw))
@@ -229,6 +267,9 @@ func copyToRGBA(dst []byte, src *image.RGBA) {
 	}
 }
 
-func updateInput(t *float64, lastT float64) *float64 {
-	return t
+// copyToGen, allocates...
+func copyToGen(dst []byte, src image.Image) {
+	rgba := image.NewRGBA(src.Bounds())
+	draw.Draw(rgba, rgba.Rect, src, rgba.Rect.Min, draw.Src)
+	copyToRGBA(dst, rgba)
 }
@@ -0,0 +1,200 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+)
+
+// GrayChannel selects what is used as grey value.
+type GrayChannel int
+
+const (
+	// GrayLuma uses weighted luma of the red, green and blue channels.
+	GrayLuma GrayChannel = iota
+	GrayRed
+	GrayGreen
+	GrayBlue
+	GrayAlpha
+)
+
+// LumaCoefficients are the weights used for GrayLuma.
+type LumaCoefficients struct {
+	R, G, B float64
+}
+
+var (
+	// Rec601 luma coefficients. This is what ToGray uses.
+	Rec601 = LumaCoefficients{R: 0.299, G: 0.587, B: 0.114}
+	// Rec709 luma coefficients. This matches sRGB primaries.
+	Rec709 = LumaCoefficients{R: 0.2126, G: 0.7152, B: 0.0722}
+)
+
+// GrayOptions control conversion to grey.
+// The zero value converts using Rec601 luma on gamma encoded values.
+type GrayOptions struct {
+	Channel GrayChannel
+
+	// Coefficients used for GrayLuma. If zero, Rec601 is used.
+	Coefficients LumaCoefficients
+
+	// Linear converts red, green and blue from sRGB to linear light before
+	// they are weighted. The output is linear as well.
+	Linear bool
+
+	// Black and White remap the input range, so Black becomes 0 and White the maximum value.
+	// Values are 0 -> 1. If White is 0, 1 is used.
+	Black, White float64
+
+	// Gamma is applied after remapping levels. If 0, 1 is used.
+	Gamma float64
+
+	// Equalize will equalize the histogram of the output.
+	Equalize bool
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// grayValues returns the converted values of img with 16 bit precision.
+func (o GrayOptions) grayValues(img image.Image) []uint16 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	coeff := o.Coefficients
+	if coeff == (LumaCoefficients{}) {
+		coeff = Rec601
+	}
+	white := o.White
+	if white == 0 {
+		white = 1
+	}
+	gamma := o.Gamma
+	if gamma == 0 {
+		gamma = 1
+	}
+	res := make([]uint16, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA64Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA64)
+			r, g, bl, a := float64(c.R)/0xffff, float64(c.G)/0xffff, float64(c.B)/0xffff, float64(c.A)/0xffff
+			if o.Linear {
+				r, g, bl = srgbToLinear(r), srgbToLinear(g), srgbToLinear(bl)
+			}
+			var v float64
+			switch o.Channel {
+			case GrayRed:
+				v = r
+			case GrayGreen:
+				v = g
+			case GrayBlue:
+				v = bl
+			case GrayAlpha:
+				v = a
+			default:
+				v = r*coeff.R + g*coeff.G + bl*coeff.B
+			}
+			if white != o.Black {
+				v = (v - o.Black) / (white - o.Black)
+			}
+			v = math.Max(0, math.Min(1, v))
+			if gamma != 1 {
+				v = math.Pow(v, 1/gamma)
+			}
+			res[y*w+x] = uint16(v*0xffff + 0.5)
+		}
+	}
+	if o.Equalize {
+		equalize(res)
+	}
+	return res
+}
+
+// equalize the histogram of the values.
+func equalize(v []uint16) {
+	if len(v) == 0 {
+		return
+	}
+	var hist [65536]int
+	for _, x := range v {
+		hist[x]++
+	}
+	// Use the count below the first used value as base, so it maps to 0.
+	var cdf [65536]int
+	sum, base := 0, -1
+	for i, n := range hist {
+		sum += n
+		cdf[i] = sum
+		if base < 0 && n > 0 {
+			base = n
+		}
+	}
+	if sum == base {
+		return
+	}
+	for i, x := range v {
+		v[i] = uint16((cdf[x] - base) * 0xffff / (sum - base))
+	}
+}
+
+// ToGrayOpt converts img to grey using the supplied options.
+func ToGrayOpt(img image.Image, o GrayOptions) *image.Gray {
+	vals := o.grayValues(img)
+	grey := image.NewGray(img.Bounds())
+	w := grey.Rect.Dx()
+	for y := 0; y < grey.Rect.Dy(); y++ {
+		line := vals[y*w : y*w+w]
+		dLine := grey.Pix[y*grey.Stride : y*grey.Stride+w]
+		for x, v := range line {
+			dLine[x] = uint8((uint32(v)*255 + 0x7fff) / 0xffff)
+		}
+	}
+	return grey
+}
+
+// ToGray16 converts img to 16 bit grey using the supplied options.
+func ToGray16(img image.Image, o GrayOptions) *image.Gray16 {
+	vals := o.grayValues(img)
+	grey := image.NewGray16(img.Bounds())
+	w := grey.Rect.Dx()
+	for y := 0; y < grey.Rect.Dy(); y++ {
+		line := vals[y*w : y*w+w]
+		dLine := grey.Pix[y*grey.Stride : y*grey.Stride+w*2]
+		for x, v := range line {
+			dLine[x*2] = uint8(v >> 8)
+			dLine[x*2+1] = uint8(v)
+		}
+	}
+	return grey
+}
+
+// LoadGreyPictureOpt loads a picture and converts it to grey using the supplied options.
+func LoadGreyPictureOpt(path string, o GrayOptions) (*image.Gray, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewBuffer(dat))
+	if err != nil {
+		return nil, err
+	}
+	return ToGrayOpt(img, o), nil
+}
+
+// LoadGrey16Picture loads a picture as 16 bit grey using the supplied options.
+// 16 bit PNGs keep their full precision.
+func LoadGrey16Picture(path string, o GrayOptions) (*image.Gray16, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewBuffer(dat))
+	if err != nil {
+		return nil, err
+	}
+	return ToGray16(img, o), nil
+}
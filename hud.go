@@ -0,0 +1,244 @@
+package gfx
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Marker names the part of an effect starting at At, 0 -> 1.
+type Marker struct {
+	At   float64
+	Name string
+}
+
+var scenes struct {
+	mu      sync.Mutex
+	markers []Marker
+	scene   string
+}
+
+// SetMarkers sets the markers shown as the scene name in the HUD.
+func SetMarkers(m ...Marker) {
+	m = append([]Marker(nil), m...)
+	sort.Slice(m, func(i, j int) bool { return m[i].At < m[j].At })
+	scenes.mu.Lock()
+	scenes.markers = m
+	scenes.mu.Unlock()
+}
+
+// SetScene sets the scene name shown in the HUD.
+// It can be called from Render and is used instead of the markers until
+// it is set to "".
+func SetScene(name string) {
+	scenes.mu.Lock()
+	scenes.scene = name
+	scenes.mu.Unlock()
+}
+
+// sceneName returns the scene at t.
+func sceneName(t float64) string {
+	scenes.mu.Lock()
+	defer scenes.mu.Unlock()
+	if scenes.scene != "" {
+		return scenes.scene
+	}
+	name := ""
+	for _, m := range scenes.markers {
+		if m.At > t {
+			break
+		}
+		name = m.Name
+	}
+	return name
+}
+
+// statsHistory is the number of frames shown in the graph.
+const statsHistory = 128
+
+// statsInterval is how often FPS and vFPS are updated.
+const statsInterval = time.Second / 2
+
+// frameRecord is the timing of a frame.
+type frameRecord struct {
+	at    time.Time
+	t     float64
+	total time.Duration
+
+	// sections are the times of the sections by index.
+	sections []time.Duration
+}
+
+// frameStats collects the frame times of a runner.
+type frameStats struct {
+	// frame is the number of frames rendered.
+	frame int
+
+	// history is the frames of the last ProfileHistory,
+	// and at least statsHistory frames.
+	history []frameRecord
+
+	// fps is the number of frames shown per second and vfps the number
+	// of frames that could be rendered per second, over the last interval.
+	fps, vfps float64
+
+	n     int
+	spent time.Duration
+	start time.Time
+}
+
+func newFrameStats() *frameStats {
+	return &frameStats{start: time.Now()}
+}
+
+// add the render time of the frame at t and the times of its sections.
+// true is returned when fps and vfps are updated.
+func (s *frameStats) add(t float64, spent time.Duration, sections []time.Duration) bool {
+	now := time.Now()
+	s.history = append(s.history, frameRecord{at: now, t: t, total: spent, sections: sections})
+	drop := 0
+	for len(s.history)-drop > statsHistory && now.Sub(s.history[drop].at) > ProfileHistory {
+		drop++
+	}
+	s.history = s.history[drop:]
+
+	s.frame++
+	s.n++
+	s.spent += spent
+	elapsed := now.Sub(s.start)
+	if elapsed < statsInterval {
+		return false
+	}
+	s.fps = float64(s.n) * float64(time.Second) / float64(elapsed)
+	if s.spent > 0 {
+		s.vfps = float64(s.n) * float64(time.Second) / float64(s.spent)
+	}
+	s.n, s.spent, s.start = 0, 0, now
+	return true
+}
+
+// recent returns the frames shown in the graph.
+func (s *frameStats) recent() []frameRecord {
+	if len(s.history) > statsHistory {
+		return s.history[len(s.history)-statsHistory:]
+	}
+	return s.history
+}
+
+// status returns the statistics for the window title or status line.
+func (s *frameStats) status(t float64) string {
+	return fmt.Sprintf("time: %0.3f | FPS: %.0f | vFPS: %.0f", t, s.fps, s.vfps)
+}
+
+// Layout of the HUD. It is placed in the bottom left corner.
+// The graph is scaled so 1/hudGraphHz seconds is the full height.
+const (
+	hudW         = statsHistory + 10 + 3*fontWidth
+	hudGraphH    = 64
+	hudGraphHz   = 24
+	hudLines     = 3
+	hudMaxLegend = 6
+)
+
+// hudBudgets are the refresh rates marked in the graph.
+var hudBudgets = []int{30, 60, 120}
+
+// sectionColors are the colours of named sections in the graph.
+var sectionColors = []color.RGBA{
+	{R: 80, G: 140, B: 230, A: 255},
+	{R: 230, G: 180, B: 60, A: 255},
+	{R: 200, G: 90, B: 220, A: 255},
+	{R: 70, G: 210, B: 210, A: 255},
+	{R: 240, G: 130, B: 80, A: 255},
+	{R: 170, G: 220, B: 90, A: 255},
+}
+
+// sectionColor returns the colour of section i.
+// Section 0 is green, or red if the frame is over budget.
+func sectionColor(i int, over bool) color.RGBA {
+	switch {
+	case i > 0:
+		return sectionColors[(i-1)%len(sectionColors)]
+	case over:
+		return overlayWarn
+	}
+	return overlayAccent
+}
+
+// graphHeight returns the height of d in the graph.
+func graphHeight(d time.Duration) int {
+	return int(int64(d) * hudGraphH * hudGraphHz / int64(time.Second))
+}
+
+// drawHUD draws the statistics of the frame at t on dst.
+func drawHUD(dst draw.Image, s *frameStats, t float64) {
+	recent := s.recent()
+	names := sectionNames()
+	legend := len(names)
+	switch {
+	case legend == 1:
+		// Only time outside sections.
+		legend = 0
+	case legend > hudMaxLegend:
+		legend = hudMaxLegend
+	}
+	b := dst.Bounds()
+	r := image.Rect(b.Min.X, b.Max.Y-(hudLines+legend)*fontHeight-hudGraphH-8, b.Min.X+hudW, b.Max.Y)
+	fillRect(dst, r, overlayBG)
+	x, y := r.Min.X+4, r.Min.Y+2
+	drawText(dst, x, y, fmt.Sprintf("%0.4f #%d", t, s.frame), overlayText)
+	y += fontHeight
+	drawText(dst, x, y, fmt.Sprintf("FPS %.0f vFPS %.0f", s.fps, s.vfps), overlayText)
+	y += fontHeight
+	drawText(dst, x, y, sceneName(t), overlayAccent)
+	y += fontHeight + 2
+
+	// Stacked bars of the sections of each frame, newest to the right.
+	graph := image.Rect(x, y, x+statsHistory, y+hudGraphH)
+	budget := time.Second / vSync
+	gx := graph.Max.X - len(recent)
+	for i, f := range recent {
+		top := graph.Max.Y
+		for j, d := range f.sections {
+			h := graphHeight(d)
+			if h <= 0 {
+				continue
+			}
+			if top-h < graph.Min.Y {
+				h = top - graph.Min.Y
+			}
+			fillRect(dst, image.Rect(gx+i, top-h, gx+i+1, top), sectionColor(j, f.total > budget))
+			top -= h
+		}
+	}
+	for _, hz := range hudBudgets {
+		ly := graph.Max.Y - graphHeight(time.Second/time.Duration(hz))
+		fillRect(dst, image.Rect(graph.Min.X, ly, graph.Max.X, ly+1), overlayDim)
+		drawText(dst, graph.Max.X+2, ly-fontHeight/2, fmt.Sprint(hz), overlayDim)
+	}
+	y += hudGraphH + 2
+
+	// Average time of each section in the graph.
+	for i := 0; i < legend; i++ {
+		var sum time.Duration
+		for _, f := range recent {
+			if i < len(f.sections) {
+				sum += f.sections[i]
+			}
+		}
+		if len(recent) > 0 {
+			sum /= time.Duration(len(recent))
+		}
+		ms := float64(sum) / float64(time.Millisecond)
+		line := fmt.Sprintf("%.2fms %s", ms, names[i])
+		if n := (hudW - 8) / fontWidth; len(line) > n {
+			line = line[:n]
+		}
+		drawText(dst, x, y, line, sectionColor(i, false))
+		y += fontHeight
+	}
+}
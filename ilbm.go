@@ -0,0 +1,487 @@
+package gfx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+func init() {
+	image.RegisterFormat("ilbm", "FORM????ILBM", decodeILBMImage, decodeILBMConfig)
+	image.RegisterFormat("ilbm", "FORM????PBM ", decodeILBMImage, decodeILBMConfig)
+}
+
+// ColorCycle is a palette range that is rotated over time.
+// This is stored as CRNG or CCRT chunks in IFF ILBM files.
+type ColorCycle struct {
+	// Low and High are the first and last palette index of the range, inclusive.
+	Low, High uint8
+
+	// Rate is the number of steps per second.
+	Rate float64
+
+	// Reverse will rotate colours towards lower indexes.
+	Reverse bool
+}
+
+// Apply returns a copy of p with the cycle applied at time t in seconds.
+func (c ColorCycle) Apply(p color.Palette, t float64) color.Palette {
+	dst := append(color.Palette(nil), p...)
+	lo, hi := int(c.Low), int(c.High)
+	if hi >= len(p) {
+		hi = len(p) - 1
+	}
+	n := hi - lo + 1
+	if n <= 1 || c.Rate <= 0 {
+		return dst
+	}
+	steps := int(math.Floor(t*c.Rate)) % n
+	if steps < 0 {
+		steps += n
+	}
+	for i := 0; i < n; i++ {
+		// Moving forward shifts colours towards higher indexes.
+		src := i - steps
+		if c.Reverse {
+			src = i + steps
+		}
+		src = ((src % n) + n) % n
+		dst[lo+i] = p[lo+src]
+	}
+	return dst
+}
+
+// CyclePalette applies all cycles to p at time t in seconds.
+func CyclePalette(p color.Palette, cycles []ColorCycle, t float64) color.Palette {
+	for _, c := range cycles {
+		p = c.Apply(p, t)
+	}
+	return p
+}
+
+// ILBM is a decoded IFF ILBM or PBM image.
+type ILBM struct {
+	// Image is *image.Paletted, except for HAM and 24 bit images
+	// which are returned as *image.RGBA.
+	Image image.Image
+
+	// Cycles contains the active colour cycling ranges.
+	Cycles []ColorCycle
+
+	// HAM and EHB are set if the image uses hold-and-modify or extra-halfbrite modes.
+	HAM, EHB bool
+}
+
+// LoadILBM loads an IFF ILBM image including colour cycling information.
+func LoadILBM(path string) (*ILBM, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeILBM(bytes.NewReader(dat))
+}
+
+const (
+	camgEHB = 0x80
+	camgHAM = 0x800
+
+	mskHasMask          = 1
+	mskTransparentColor = 2
+)
+
+type ilbmHeader struct {
+	Width, Height    uint16
+	X, Y             int16
+	Planes           uint8
+	Masking          uint8
+	Compression      uint8
+	Pad              uint8
+	TransparentColor uint16
+	XAspect, YAspect uint8
+	PageW, PageH     int16
+}
+
+type ilbmChunks struct {
+	pbm    bool
+	hdr    *ilbmHeader
+	cmap   []byte
+	camg   uint32
+	body   []byte
+	cycles []ColorCycle
+}
+
+var errILBM = errors.New("ilbm: invalid format")
+
+func readILBMChunks(r io.Reader, headerOnly bool) (*ilbmChunks, error) {
+	br := bufio.NewReader(r)
+	var form [12]byte
+	if _, err := io.ReadFull(br, form[:]); err != nil {
+		return nil, err
+	}
+	if string(form[:4]) != "FORM" {
+		return nil, errILBM
+	}
+	var c ilbmChunks
+	switch string(form[8:]) {
+	case "ILBM":
+	case "PBM ":
+		c.pbm = true
+	default:
+		return nil, errILBM
+	}
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(br, ch[:]); err != nil {
+			if err == io.EOF && c.hdr != nil {
+				break
+			}
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(ch[4:]))
+		// Chunks are padded to even sizes.
+		padded := size + size&1
+		id := string(ch[:4])
+		if id != "BMHD" && id != "CMAP" && id != "CAMG" && id != "BODY" && id != "CRNG" && id != "CCRT" {
+			if _, err := io.CopyN(ioutil.Discard, br, padded); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if size > 64<<20 {
+			return nil, errILBM
+		}
+		// Read instead of allocating the size, which may be bogus.
+		data, err := ioutil.ReadAll(io.LimitReader(br, padded))
+		if err != nil {
+			return nil, err
+		}
+		// Allow the pad byte of the last chunk to be missing.
+		if int64(len(data)) < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		data = data[:size]
+		switch id {
+		case "BMHD":
+			var h ilbmHeader
+			if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &h); err != nil {
+				return nil, errILBM
+			}
+			c.hdr = &h
+		case "CMAP":
+			c.cmap = data
+		case "CAMG":
+			if len(data) >= 4 {
+				c.camg = binary.BigEndian.Uint32(data)
+			}
+		case "CRNG":
+			if len(data) < 8 {
+				continue
+			}
+			rate := int16(binary.BigEndian.Uint16(data[2:]))
+			flags := binary.BigEndian.Uint16(data[4:])
+			// Inactive ranges are often stored with bogus values.
+			if flags&1 == 0 || rate <= 0 || data[6] >= data[7] {
+				continue
+			}
+			c.cycles = append(c.cycles, ColorCycle{
+				Low:     data[6],
+				High:    data[7],
+				Rate:    float64(rate) * 60 / 16384,
+				Reverse: flags&2 != 0,
+			})
+		case "CCRT":
+			if len(data) < 14 {
+				continue
+			}
+			dir := int16(binary.BigEndian.Uint16(data))
+			secs := binary.BigEndian.Uint32(data[4:])
+			micros := binary.BigEndian.Uint32(data[8:])
+			delay := float64(secs) + float64(micros)/1e6
+			if dir == 0 || delay <= 0 || data[2] >= data[3] {
+				continue
+			}
+			c.cycles = append(c.cycles, ColorCycle{
+				Low:     data[2],
+				High:    data[3],
+				Rate:    1 / delay,
+				Reverse: dir < 0,
+			})
+		case "BODY":
+			c.body = data
+			if c.hdr == nil {
+				return nil, errILBM
+			}
+			return &c, nil
+		}
+		// CMAP is needed for the color model.
+		if headerOnly && c.hdr != nil && c.cmap != nil {
+			return &c, nil
+		}
+	}
+	if c.hdr == nil {
+		return nil, errILBM
+	}
+	return &c, nil
+}
+
+// ham returns whether the image uses hold and modify.
+// Only 6 and 8 planes are supported, other depths are paletted.
+func (c *ilbmChunks) ham() bool {
+	planes := c.hdr.Planes
+	return c.camg&camgHAM != 0 && (planes == 6 || planes == 8)
+}
+
+// palette returns the palette of the image.
+func (c *ilbmChunks) palette() color.Palette {
+	planes := int(c.hdr.Planes)
+	n := len(c.cmap) / 3
+	if c.ham() {
+		n = 1 << uint(planes-2)
+	} else if planes <= 8 && n < 1<<uint(planes) {
+		n = 1 << uint(planes)
+	}
+	if n > 256 {
+		n = 256
+	}
+	cmap := c.cmap
+	// Old files store 4 bit colours in the upper nibble.
+	scale := len(cmap) > 0
+	for _, v := range cmap {
+		if v&15 != 0 {
+			scale = false
+			break
+		}
+	}
+	pal := make(color.Palette, n)
+	for i := range pal {
+		var rgb [3]uint8
+		if i*3+3 <= len(cmap) {
+			copy(rgb[:], cmap[i*3:])
+		}
+		if scale {
+			for j := range rgb {
+				rgb[j] |= rgb[j] >> 4
+			}
+		}
+		pal[i] = color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}
+	}
+	if c.camg&camgEHB != 0 && planes == 6 {
+		pal = append(pal[:32:32], make(color.Palette, 32)...)
+		for i := 0; i < 32; i++ {
+			r, g, b, _ := pal[i].RGBA()
+			pal[32+i] = color.RGBA{R: uint8(r >> 9), G: uint8(g >> 9), B: uint8(b >> 9), A: 255}
+		}
+	}
+	if c.hdr.Masking == mskTransparentColor && int(c.hdr.TransparentColor) < len(pal) {
+		pal[c.hdr.TransparentColor] = color.RGBA{}
+	}
+	return pal
+}
+
+// unpackByteRun1 decompresses src into dst.
+// An error is returned if more than max bytes would be added to dst.
+func unpackByteRun1(dst, src []byte, max int) ([]byte, error) {
+	max += len(dst)
+	for len(src) > 0 {
+		n := int8(src[0])
+		src = src[1:]
+		switch {
+		case n >= 0:
+			cnt := int(n) + 1
+			if cnt > len(src) || len(dst)+cnt > max {
+				return dst, errILBM
+			}
+			dst = append(dst, src[:cnt]...)
+			src = src[cnt:]
+		case n != -128:
+			if len(src) == 0 || len(dst)+int(-n)+1 > max {
+				return dst, errILBM
+			}
+			for i := 0; i < int(-n)+1; i++ {
+				dst = append(dst, src[0])
+			}
+			src = src[1:]
+		}
+	}
+	return dst, nil
+}
+
+// maxPrealloc is the largest buffer allocated by image decoders
+// from sizes read from a file. Larger buffers grow as data is read.
+const maxPrealloc = 1 << 20
+
+// preallocSize returns the capacity to allocate for a buffer of size bytes.
+func preallocSize(size int) int {
+	if size > maxPrealloc {
+		size = maxPrealloc
+	}
+	return size
+}
+
+// DecodeILBM decodes an IFF ILBM or PBM image.
+func DecodeILBM(r io.Reader) (*ILBM, error) {
+	c, err := readILBMChunks(r, false)
+	if err != nil {
+		return nil, err
+	}
+	if c.body == nil {
+		return nil, errors.New("ilbm: no BODY chunk")
+	}
+	h := c.hdr
+	w, ht, planes := int(h.Width), int(h.Height), int(h.Planes)
+	if w == 0 || ht == 0 || planes == 0 || (planes > 8 && planes != 24 && planes != 32) {
+		return nil, fmt.Errorf("ilbm: unsupported format %dx%d, %d planes", w, ht, planes)
+	}
+	rowBytes := ((w + 15) / 16) * 2
+	rowPlanes := planes
+	if h.Masking == mskHasMask {
+		rowPlanes++
+	}
+	size := rowBytes * rowPlanes * ht
+	if c.pbm {
+		// Chunky pixels, with lines padded to even length.
+		size = (w + w&1) * ht
+	}
+	body := c.body
+	switch h.Compression {
+	case 0:
+	case 1:
+		body, err = unpackByteRun1(make([]byte, 0, preallocSize(size)), body, size)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("ilbm: unsupported compression %d", h.Compression)
+	}
+
+	res := ILBM{
+		Cycles: c.cycles,
+		HAM:    c.ham(),
+		EHB:    c.camg&camgEHB != 0 && planes == 6,
+	}
+	pal := c.palette()
+	rect := image.Rect(0, 0, w, ht)
+
+	if c.pbm {
+		if planes != 8 {
+			return nil, fmt.Errorf("ilbm: unsupported PBM depth %d", planes)
+		}
+		stride := w + w&1
+		if len(body) < stride*ht {
+			return nil, io.ErrUnexpectedEOF
+		}
+		img := image.NewPaletted(rect, pal)
+		for y := 0; y < ht; y++ {
+			copy(img.Pix[y*img.Stride:y*img.Stride+w], body[y*stride:])
+		}
+		res.Image = img
+		return &res, nil
+	}
+
+	if len(body) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// Convert planes to chunky values.
+	vals := make([]uint32, w)
+	line := func(y int) []uint32 {
+		for x := range vals {
+			vals[x] = 0
+		}
+		row := body[y*rowBytes*rowPlanes:]
+		for p := 0; p < planes; p++ {
+			plane := row[p*rowBytes : (p+1)*rowBytes]
+			bit := uint32(1) << uint(p)
+			for x := range vals {
+				if plane[x>>3]&(0x80>>uint(x&7)) != 0 {
+					vals[x] |= bit
+				}
+			}
+		}
+		return vals
+	}
+
+	switch {
+	case planes == 24 || planes == 32:
+		img := image.NewRGBA(rect)
+		for y := 0; y < ht; y++ {
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w*4]
+			for x, v := range line(y) {
+				dLine[x*4+0] = uint8(v)
+				dLine[x*4+1] = uint8(v >> 8)
+				dLine[x*4+2] = uint8(v >> 16)
+				dLine[x*4+3] = 255
+				if planes == 32 {
+					dLine[x*4+3] = uint8(v >> 24)
+				}
+			}
+		}
+		res.Image = img
+	case res.HAM:
+		img := image.NewRGBA(rect)
+		valBits := uint(planes - 2)
+		for y := 0; y < ht; y++ {
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w*4]
+			r, g, b, _ := pal[0].RGBA()
+			cur := [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+			for x, v := range line(y) {
+				ctrl, val := v>>valBits, v&(1<<valBits-1)
+				// Expand value to 8 bits.
+				v8 := uint8(val << (8 - valBits))
+				v8 |= v8 >> valBits
+				switch ctrl {
+				case 0:
+					r, g, b, _ := pal[val].RGBA()
+					cur = [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+				case 1:
+					cur[2] = v8
+				case 2:
+					cur[0] = v8
+				case 3:
+					cur[1] = v8
+				}
+				dLine[x*4+0] = cur[0]
+				dLine[x*4+1] = cur[1]
+				dLine[x*4+2] = cur[2]
+				dLine[x*4+3] = 255
+			}
+		}
+		res.Image = img
+	default:
+		img := image.NewPaletted(rect, pal)
+		for y := 0; y < ht; y++ {
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w]
+			for x, v := range line(y) {
+				dLine[x] = uint8(v)
+			}
+		}
+		res.Image = img
+	}
+	return &res, nil
+}
+
+func decodeILBMImage(r io.Reader) (image.Image, error) {
+	img, err := DecodeILBM(r)
+	if err != nil {
+		return nil, err
+	}
+	return img.Image, nil
+}
+
+func decodeILBMConfig(r io.Reader) (image.Config, error) {
+	c, err := readILBMChunks(r, true)
+	if err != nil {
+		return image.Config{}, err
+	}
+	cfg := image.Config{Width: int(c.hdr.Width), Height: int(c.hdr.Height), ColorModel: color.RGBAModel}
+	if c.hdr.Planes <= 8 && c.camg&camgHAM == 0 {
+		cfg.ColorModel = c.palette()
+	}
+	return cfg, nil
+}
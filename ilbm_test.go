@@ -0,0 +1,114 @@
+package gfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// ilbmFile returns an ILBM file with the header and chunks.
+// Chunks are given as id followed by data.
+func ilbmFile(h ilbmHeader, chunks ...interface{}) []byte {
+	var body bytes.Buffer
+	body.WriteString("ILBM")
+	writeChunk := func(id string, data []byte) {
+		body.WriteString(id)
+		binary.Write(&body, binary.BigEndian, uint32(len(data)))
+		body.Write(data)
+		if len(data)&1 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.BigEndian, h)
+	writeChunk("BMHD", hdr.Bytes())
+	for i := 0; i < len(chunks); i += 2 {
+		writeChunk(chunks[i].(string), chunks[i+1].([]byte))
+	}
+	var b bytes.Buffer
+	b.WriteString("FORM")
+	binary.Write(&b, binary.BigEndian, uint32(body.Len()))
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+func TestDecodeILBM(t *testing.T) {
+	// 16x2 pixels, 2 planes.
+	// Row 0 is colour 1 on the left and 2 on the right, row 1 is colour 3.
+	body := []byte{
+		0x01, 0xff, 0x00, // Plane 0: 0xff, 0x00.
+		0x01, 0x00, 0xff, // Plane 1: 0x00, 0xff.
+		0xff, 0xff, // Plane 0: 0xff repeated.
+		0xff, 0xff, // Plane 1: 0xff repeated.
+	}
+	cmap := []byte{0, 0, 0, 255, 0, 0, 0, 255, 0, 0, 0, 255}
+	crng := []byte{0, 0, 0x10, 0, 0, 1, 1, 3}
+	b := ilbmFile(ilbmHeader{Width: 16, Height: 2, Planes: 2, Compression: 1},
+		"CMAP", cmap, "CRNG", crng, "BODY", body)
+	res, err := DecodeILBM(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, ok := res.Image.(*image.Paletted)
+	if !ok {
+		t.Fatalf("got %T, want *image.Paletted", res.Image)
+	}
+	for _, tc := range []struct{ x, y, want int }{{0, 0, 1}, {7, 0, 1}, {8, 0, 2}, {15, 0, 2}, {0, 1, 3}} {
+		if got := int(img.ColorIndexAt(tc.x, tc.y)); got != tc.want {
+			t.Errorf("pixel %d,%d: got %d, want %d", tc.x, tc.y, got, tc.want)
+		}
+	}
+	if img.Palette[1] != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("got colour %v", img.Palette[1])
+	}
+	if len(res.Cycles) != 1 || res.Cycles[0].Low != 1 || res.Cycles[0].High != 3 {
+		t.Errorf("got cycles %+v", res.Cycles)
+	}
+	if _, format, err := image.Decode(bytes.NewReader(b)); err != nil || format != "ilbm" {
+		t.Errorf("image.Decode: %v, %q", err, format)
+	}
+}
+
+func TestDecodeILBMHAMDepth(t *testing.T) {
+	// HAM is only used with 6 and 8 planes, so this is a paletted image.
+	body := make([]byte, 2*4)
+	body[0], body[4] = 0x80, 0x80
+	b := ilbmFile(ilbmHeader{Width: 8, Height: 1, Planes: 4},
+		"CAMG", []byte{0, 0, 0x08, 0}, "BODY", body)
+	res, err := DecodeILBM(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, ok := res.Image.(*image.Paletted)
+	if !ok || res.HAM {
+		t.Fatalf("got %T, HAM %v", res.Image, res.HAM)
+	}
+	if len(img.Palette) != 16 || img.ColorIndexAt(0, 0) != 5 {
+		t.Errorf("got %d colours, index %d", len(img.Palette), img.ColorIndexAt(0, 0))
+	}
+	img.At(0, 0)
+}
+
+func TestDecodeILBMCorrupt(t *testing.T) {
+	for name, b := range map[string][]byte{
+		// The size is only limited by the header fields.
+		"huge": ilbmFile(ilbmHeader{Width: 65535, Height: 65535, Planes: 8, Compression: 1},
+			"BODY", []byte{0x81, 0}),
+		// The body decompresses to more than the image.
+		"overrun": ilbmFile(ilbmHeader{Width: 16, Height: 1, Planes: 1, Compression: 1},
+			"BODY", []byte{0x81, 0, 0x81, 0}),
+		"no body": ilbmFile(ilbmHeader{Width: 16, Height: 1, Planes: 1}),
+	} {
+		if _, err := DecodeILBM(bytes.NewReader(b)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	b := ilbmFile(ilbmHeader{Width: 16, Height: 1, Planes: 1}, "BODY", []byte{1, 2})
+	for n := 0; n < len(b); n++ {
+		if _, err := DecodeILBM(bytes.NewReader(b[:n])); err == nil {
+			t.Errorf("%d bytes: no error", n)
+		}
+	}
+}
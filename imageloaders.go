@@ -1,28 +1,50 @@
 package gfx
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
 )
 
+// LoadPalPicture loads a paletted picture.
+// Grey images get a grey palette, true colour images
+// are quantized to 256 colours without dithering.
 func LoadPalPicture(path string) (*image.Paletted, error) {
+	return LoadPalPictureQuantized(path, Quantize{})
+}
+
+// LoadPalPictureQuantized loads a paletted picture.
+// Images that are not paletted or grey are converted using q.
+// Paletted and grey images are also converted if q sets Palette or Colors,
+// otherwise they keep their palette.
+func LoadPalPictureQuantized(path string, q Quantize) (*image.Paletted, error) {
 	dat, err := Load(path)
 	if err != nil {
 		return nil, err
 	}
+	return decodePalPicture(dat, q)
+}
+
+func decodePalPicture(dat []byte, q Quantize) (*image.Paletted, error) {
 	img, _, err := image.Decode(bytes.NewBuffer(dat))
 	if err != nil {
 		return nil, err
 	}
+	if len(q.Palette) > 0 || q.Colors > 0 {
+		return q.Paletted(img), nil
+	}
 	ipi, ok := img.(*image.Paletted)
 	if !ok {
 		gray, ok := img.(*image.Gray)
 		if !ok {
-			return nil, fmt.Errorf("unexpected type %T", img)
+			return q.Paletted(img), nil
 		}
 		pal := make(color.Palette, 256)
 		for i := range pal {
@@ -34,11 +56,95 @@ func LoadPalPicture(path string) (*image.Paletted, error) {
 	return ipi, nil
 }
 
+// LoadPalPictureKeyed loads a paletted picture like LoadPalPicture
+// and returns the index of the transparent colour, for example from a PNG tRNS chunk.
+// If there is no transparent colour, -1 is returned.
+func LoadPalPictureKeyed(path string) (*image.Paletted, int, error) {
+	img, err := LoadPalPicture(path)
+	if err != nil {
+		return nil, -1, err
+	}
+	return img, TransparentIndex(img.Palette), nil
+}
+
+// TransparentIndex returns the index of the first fully transparent
+// colour in the palette or -1 if none.
+func TransparentIndex(p color.Palette) int {
+	for i, col := range p {
+		if _, _, _, a := col.RGBA(); a == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// DrawKeyed draws the src image at sp onto the rectangle r of dst.
+// Pixels with the index key are skipped. Both images must use the same palette.
+func DrawKeyed(dst *image.Paletted, r image.Rectangle, src *image.Paletted, sp image.Point, key int) {
+	// Clip to both images.
+	r = r.Intersect(dst.Rect)
+	sr := r.Add(sp.Sub(r.Min)).Intersect(src.Rect)
+	r = sr.Sub(sp.Sub(r.Min))
+	if r.Empty() {
+		return
+	}
+	w := r.Dx()
+	for y := 0; y < r.Dy(); y++ {
+		line := src.Pix[src.PixOffset(sr.Min.X, sr.Min.Y+y):][:w]
+		dLine := dst.Pix[dst.PixOffset(r.Min.X, r.Min.Y+y):][:w]
+		for x, v := range line {
+			if int(v) != key {
+				dLine[x] = v
+			}
+		}
+	}
+}
+
+// LoadRGBAPicture loads a picture with premultiplied alpha.
+func LoadRGBAPicture(path string) (*image.RGBA, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewBuffer(dat))
+	if err != nil {
+		return nil, err
+	}
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba, nil
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, rgba.Rect.Min, draw.Src)
+	return rgba, nil
+}
+
+// LoadNRGBAPicture loads a picture with straight, non-premultiplied alpha.
+func LoadNRGBAPicture(path string) (*image.NRGBA, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewBuffer(dat))
+	if err != nil {
+		return nil, err
+	}
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba, nil
+	}
+	nrgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(nrgba, nrgba.Rect, img, nrgba.Rect.Min, draw.Src)
+	return nrgba, nil
+}
+
 func LoadGreyPicture(path string) (*image.Gray, error) {
 	dat, err := Load(path)
 	if err != nil {
 		return nil, err
 	}
+	return decodeGreyPicture(dat)
+}
+
+func decodeGreyPicture(dat []byte) (*image.Gray, error) {
 	img, _, err := image.Decode(bytes.NewBuffer(dat))
 	if err != nil {
 		return nil, err
@@ -49,3 +155,85 @@ func LoadGreyPicture(path string) (*image.Gray, error) {
 	}
 	return ToGray(img), nil
 }
+
+// LoadGreyPictureQuantized loads a picture as grey,
+// reduced to the levels specified by q.
+func LoadGreyPictureQuantized(path string, q Quantize) (*image.Gray, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewBuffer(dat))
+	if err != nil {
+		return nil, err
+	}
+	return q.Gray(img), nil
+}
+
+// LoadPalette loads a palette.
+// JASC-PAL text files and raw 768 byte RGB palettes (.pal/.act) are supported.
+// Other files are decoded as images and the palette of the image is returned.
+func LoadPalette(path string) (color.Palette, error) {
+	dat, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodePalette(dat)
+}
+
+func decodePalette(dat []byte) (color.Palette, error) {
+	switch {
+	case bytes.HasPrefix(dat, []byte("JASC-PAL")):
+		return decodeJASCPalette(dat)
+	case len(dat) == 768 || len(dat) == 772:
+		// Adobe color tables may have the number of entries appended.
+		n := 256
+		if len(dat) == 772 {
+			if v := int(dat[768])<<8 | int(dat[769]); v > 0 && v <= 256 {
+				n = v
+			}
+		}
+		pal := make(color.Palette, n)
+		for i := range pal {
+			pal[i] = color.RGBA{R: dat[i*3], G: dat[i*3+1], B: dat[i*3+2], A: 255}
+		}
+		return pal, nil
+	}
+	img, _, err := image.Decode(bytes.NewBuffer(dat))
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := img.(*image.Paletted); ok {
+		return p.Palette, nil
+	}
+	return Quantize{}.Paletted(img).Palette, nil
+}
+
+func decodeJASCPalette(dat []byte) (color.Palette, error) {
+	sc := bufio.NewScanner(bytes.NewReader(dat))
+	var lines []string
+	for sc.Scan() {
+		if l := string(bytes.TrimSpace(sc.Bytes())); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) < 3 {
+		return nil, errors.New("jasc-pal: short file")
+	}
+	var n int
+	if _, err := fmt.Sscan(lines[2], &n); err != nil {
+		return nil, fmt.Errorf("jasc-pal: reading count: %v", err)
+	}
+	if n < 0 || n > 256 || len(lines) < 3+n {
+		return nil, fmt.Errorf("jasc-pal: invalid count %d", n)
+	}
+	pal := make(color.Palette, n)
+	for i := range pal {
+		var r, g, b uint8
+		if _, err := fmt.Sscan(lines[3+i], &r, &g, &b); err != nil {
+			return nil, fmt.Errorf("jasc-pal: entry %d: %v", i, err)
+		}
+		pal[i] = color.RGBA{R: r, G: g, B: b, A: 255}
+	}
+	return pal, nil
+}
@@ -0,0 +1,36 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestDecodeBMP(t *testing.T) {
+	src := image.NewPaletted(image.Rect(0, 0, 3, 2), color.Palette{color.Black, color.White})
+	src.SetColorIndex(1, 1, 1)
+	var b bytes.Buffer
+	if err := bmp.Encode(&b, src); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "bmp" || img.Bounds() != src.Bounds() {
+		t.Fatalf("got %q, %v", format, img.Bounds())
+	}
+	if r, _, _, _ := img.At(1, 1).RGBA(); r != 0xffff {
+		t.Errorf("got %v, want white", img.At(1, 1))
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0 {
+		t.Errorf("got %v, want black", img.At(0, 0))
+	}
+	// Truncated after the file header.
+	if _, _, err := image.Decode(bytes.NewReader(b.Bytes()[:20])); err == nil {
+		t.Error("truncated: no error")
+	}
+}
@@ -0,0 +1,267 @@
+package gfx
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// Key is a keyboard key.
+// Keys are the same for all backends.
+type Key int
+
+const (
+	KeyUnknown Key = iota
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+	KeyA
+	KeyB
+	KeyC
+	KeyD
+	KeyE
+	KeyF
+	KeyG
+	KeyH
+	KeyI
+	KeyJ
+	KeyK
+	KeyL
+	KeyM
+	KeyN
+	KeyO
+	KeyP
+	KeyQ
+	KeyR
+	KeyS
+	KeyT
+	KeyU
+	KeyV
+	KeyW
+	KeyX
+	KeyY
+	KeyZ
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeySpace
+	KeyEscape
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyInsert
+	KeyDelete
+	KeyLeft
+	KeyRight
+	KeyUp
+	KeyDown
+	KeyPageUp
+	KeyPageDown
+	KeyHome
+	KeyEnd
+	KeyMinus
+	KeyEqual
+	KeyLeftBracket
+	KeyRightBracket
+	KeyComma
+	KeyPeriod
+	KeySlash
+	KeySemicolon
+	KeyApostrophe
+	KeyBackslash
+	KeyGraveAccent
+	KeyLeftShift
+	KeyRightShift
+	KeyLeftControl
+	KeyRightControl
+	KeyLeftAlt
+	KeyRightAlt
+	numKeys
+)
+
+// MouseButton is a mouse button.
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseRight
+	MouseMiddle
+	numButtons
+)
+
+// Input is the state of the keyboard and mouse for a frame.
+type Input struct {
+	// Mouse is the position of the pointer in render coordinates,
+	// with 0,0 at the top left of the effect.
+	Mouse image.Point
+
+	// MouseInside is set when the pointer is over the effect.
+	MouseInside bool
+
+	// Wheel is the scrolling since the previous frame, in steps.
+	// Positive Y is scrolling up.
+	WheelX, WheelY float64
+
+	down, pressed    [numKeys]bool
+	buttons, clicked [numButtons]bool
+
+	// read records the keys checked with Down and JustPressed, if set.
+	read *[numKeys]bool
+}
+
+// ButtonDown returns whether mouse button b is held down.
+func (in *Input) ButtonDown(b MouseButton) bool {
+	return b >= 0 && b < numButtons && in.buttons[b]
+}
+
+// ButtonPressed returns whether mouse button b was pressed since the previous frame.
+func (in *Input) ButtonPressed(b MouseButton) bool {
+	return b >= 0 && b < numButtons && in.clicked[b]
+}
+
+// Down returns whether k is held down.
+func (in *Input) Down(k Key) bool {
+	if k <= KeyUnknown || k >= numKeys {
+		return false
+	}
+	in.markRead(k)
+	return in.down[k]
+}
+
+// JustPressed returns whether k was pressed since the previous frame.
+func (in *Input) JustPressed(k Key) bool {
+	if k <= KeyUnknown || k >= numKeys {
+		return false
+	}
+	in.markRead(k)
+	return in.pressed[k]
+}
+
+// markRead records that k has been checked.
+func (in *Input) markRead(k Key) {
+	if in.read != nil {
+		in.read[k] = true
+	}
+}
+
+// Shift returns whether a shift key is held down.
+func (in *Input) Shift() bool {
+	return in.down[KeyLeftShift] || in.down[KeyRightShift]
+}
+
+// consumeKey removes k from the input.
+func (in *Input) consumeKey(k Key) {
+	in.down[k], in.pressed[k] = false, false
+}
+
+// consumeMouse removes the mouse buttons and wheel from the input.
+func (in *Input) consumeMouse() {
+	in.buttons, in.clicked = [numButtons]bool{}, [numButtons]bool{}
+	in.WheelX, in.WheelY = 0, 0
+}
+
+// inputTracker collects key events from a backend into the input of each frame.
+type inputTracker struct {
+	mu  sync.Mutex
+	cur Input
+}
+
+// keyDown is called when a key is pressed.
+// Repeated events while the key is held are ignored.
+func (t *inputTracker) keyDown(k Key) {
+	if k <= KeyUnknown || k >= numKeys {
+		return
+	}
+	t.mu.Lock()
+	if !t.cur.down[k] {
+		t.cur.pressed[k] = true
+	}
+	t.cur.down[k] = true
+	t.mu.Unlock()
+}
+
+// keyUp is called when a key is released.
+func (t *inputTracker) keyUp(k Key) {
+	if k <= KeyUnknown || k >= numKeys {
+		return
+	}
+	t.mu.Lock()
+	t.cur.down[k] = false
+	t.mu.Unlock()
+}
+
+// releaseAll releases all keys and buttons, for example when focus is lost.
+func (t *inputTracker) releaseAll() {
+	t.mu.Lock()
+	t.cur.down = [numKeys]bool{}
+	t.cur.buttons = [numButtons]bool{}
+	t.mu.Unlock()
+}
+
+// mouseMove is called when the pointer moves.
+// The position is in render coordinates.
+func (t *inputTracker) mouseMove(x, y float64, inside bool) {
+	t.mu.Lock()
+	t.cur.Mouse = image.Pt(int(math.Floor(x)), int(math.Floor(y)))
+	t.cur.MouseInside = inside
+	t.mu.Unlock()
+}
+
+// button is called when a mouse button is pressed or released.
+func (t *inputTracker) button(b MouseButton, down bool) {
+	if b < 0 || b >= numButtons {
+		return
+	}
+	t.mu.Lock()
+	if down && !t.cur.buttons[b] {
+		t.cur.clicked[b] = true
+	}
+	t.cur.buttons[b] = down
+	t.mu.Unlock()
+}
+
+// wheel is called when the mouse wheel is scrolled.
+func (t *inputTracker) wheel(x, y float64) {
+	t.mu.Lock()
+	t.cur.WheelX += x
+	t.cur.WheelY += y
+	t.mu.Unlock()
+}
+
+// frame returns the input of a frame.
+// Keys and buttons pressed since the previous frame are reported as just pressed.
+func (t *inputTracker) frame() Input {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	in := t.cur
+	t.cur.pressed = [numKeys]bool{}
+	t.cur.clicked = [numButtons]bool{}
+	t.cur.WheelX, t.cur.WheelY = 0, 0
+	return in
+}
+
+// sendInput gives the input to the effect if it is an InteractiveEffect.
+func sendInput(effect interface{}, in Input) {
+	if e, ok := effect.(InteractiveEffect); ok {
+		e.HandleInput(in)
+	}
+}
+
+// keys receives key and mouse events from the backend.
+var keys inputTracker
@@ -0,0 +1,90 @@
+// +build !wasm
+
+package gfx
+
+import "github.com/faiface/pixel/pixelgl"
+
+// pixelglKeys maps keys to pixelgl buttons.
+var pixelglKeys = map[Key]pixelgl.Button{
+	KeySpace:        pixelgl.KeySpace,
+	KeyEscape:       pixelgl.KeyEscape,
+	KeyEnter:        pixelgl.KeyEnter,
+	KeyTab:          pixelgl.KeyTab,
+	KeyBackspace:    pixelgl.KeyBackspace,
+	KeyInsert:       pixelgl.KeyInsert,
+	KeyDelete:       pixelgl.KeyDelete,
+	KeyLeft:         pixelgl.KeyLeft,
+	KeyRight:        pixelgl.KeyRight,
+	KeyUp:           pixelgl.KeyUp,
+	KeyDown:         pixelgl.KeyDown,
+	KeyPageUp:       pixelgl.KeyPageUp,
+	KeyPageDown:     pixelgl.KeyPageDown,
+	KeyHome:         pixelgl.KeyHome,
+	KeyEnd:          pixelgl.KeyEnd,
+	KeyMinus:        pixelgl.KeyMinus,
+	KeyEqual:        pixelgl.KeyEqual,
+	KeyLeftBracket:  pixelgl.KeyLeftBracket,
+	KeyRightBracket: pixelgl.KeyRightBracket,
+	KeyComma:        pixelgl.KeyComma,
+	KeyPeriod:       pixelgl.KeyPeriod,
+	KeySlash:        pixelgl.KeySlash,
+	KeySemicolon:    pixelgl.KeySemicolon,
+	KeyApostrophe:   pixelgl.KeyApostrophe,
+	KeyBackslash:    pixelgl.KeyBackslash,
+	KeyGraveAccent:  pixelgl.KeyGraveAccent,
+	KeyLeftShift:    pixelgl.KeyLeftShift,
+	KeyRightShift:   pixelgl.KeyRightShift,
+	KeyLeftControl:  pixelgl.KeyLeftControl,
+	KeyRightControl: pixelgl.KeyRightControl,
+	KeyLeftAlt:      pixelgl.KeyLeftAlt,
+	KeyRightAlt:     pixelgl.KeyRightAlt,
+}
+
+func init() {
+	for i := 0; i < 10; i++ {
+		pixelglKeys[Key0+Key(i)] = pixelgl.Key0 + pixelgl.Button(i)
+	}
+	for i := 0; i < 26; i++ {
+		pixelglKeys[KeyA+Key(i)] = pixelgl.KeyA + pixelgl.Button(i)
+	}
+	for i := 0; i < 12; i++ {
+		pixelglKeys[KeyF1+Key(i)] = pixelgl.KeyF1 + pixelgl.Button(i)
+	}
+}
+
+// pixelglButtons maps mouse buttons to pixelgl buttons.
+var pixelglButtons = [numButtons]pixelgl.Button{
+	MouseLeft:   pixelgl.MouseButtonLeft,
+	MouseRight:  pixelgl.MouseButtonRight,
+	MouseMiddle: pixelgl.MouseButtonMiddle,
+}
+
+// pollInput sends the changes of the window as events and returns the input of the frame.
+func pollInput(win *pixelgl.Window) Input {
+	for k, b := range pixelglKeys {
+		if win.JustPressed(b) {
+			keys.keyDown(k)
+		}
+		if win.JustReleased(b) {
+			keys.keyUp(k)
+		}
+	}
+	for mb, b := range pixelglButtons {
+		if win.JustPressed(b) {
+			keys.button(MouseButton(mb), true)
+		}
+		if win.JustReleased(b) {
+			keys.button(MouseButton(mb), false)
+		}
+	}
+	// The effect is drawn scaled at the center of the window with Y up.
+	p := win.MousePosition().Sub(win.Bounds().Center())
+	x := p.X/scale + fRenderWidth/2
+	y := fRenderHeight/2 - p.Y/scale
+	inside := win.MouseInsideWindow() && x >= 0 && y >= 0 && x < fRenderWidth && y < fRenderHeight
+	keys.mouseMove(x, y, inside)
+	if s := win.MouseScroll(); s.X != 0 || s.Y != 0 {
+		keys.wheel(s.X, s.Y)
+	}
+	return keys.frame()
+}
@@ -0,0 +1,148 @@
+// +build wasm
+
+package gfx
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// browserKeys maps KeyboardEvent.code to keys.
+var browserKeys = map[string]Key{
+	"Space":        KeySpace,
+	"Escape":       KeyEscape,
+	"Enter":        KeyEnter,
+	"Tab":          KeyTab,
+	"Backspace":    KeyBackspace,
+	"Insert":       KeyInsert,
+	"Delete":       KeyDelete,
+	"ArrowLeft":    KeyLeft,
+	"ArrowRight":   KeyRight,
+	"ArrowUp":      KeyUp,
+	"ArrowDown":    KeyDown,
+	"PageUp":       KeyPageUp,
+	"PageDown":     KeyPageDown,
+	"Home":         KeyHome,
+	"End":          KeyEnd,
+	"Minus":        KeyMinus,
+	"Equal":        KeyEqual,
+	"BracketLeft":  KeyLeftBracket,
+	"BracketRight": KeyRightBracket,
+	"Comma":        KeyComma,
+	"Period":       KeyPeriod,
+	"Slash":        KeySlash,
+	"Semicolon":    KeySemicolon,
+	"Quote":        KeyApostrophe,
+	"Backslash":    KeyBackslash,
+	"Backquote":    KeyGraveAccent,
+	"ShiftLeft":    KeyLeftShift,
+	"ShiftRight":   KeyRightShift,
+	"ControlLeft":  KeyLeftControl,
+	"ControlRight": KeyRightControl,
+	"AltLeft":      KeyLeftAlt,
+	"AltRight":     KeyRightAlt,
+}
+
+func init() {
+	for i := 0; i < 10; i++ {
+		browserKeys[fmt.Sprintf("Digit%d", i)] = Key0 + Key(i)
+	}
+	for i := 0; i < 26; i++ {
+		browserKeys["Key"+string('A'+rune(i))] = KeyA + Key(i)
+	}
+	for i := 0; i < 12; i++ {
+		browserKeys[fmt.Sprintf("F%d", i+1)] = KeyF1 + Key(i)
+	}
+}
+
+// preventKeys is a JavaScript Set with the codes of keys used by the runner.
+// The browser doesn't handle these keys while the canvas has focus.
+var preventKeys jsObject
+
+// prevented are the keys in preventKeys.
+var prevented [numKeys]bool
+
+// listenInput sends keyboard and mouse events of the canvas to keys.
+// The canvas is focused, so it receives the events.
+// Default actions like scrolling are prevented while the canvas has focus,
+// but only for keys used by the runner. See usedKeys.
+func listenInput(canvas jsObject) {
+	canvas.Set("tabIndex", 0)
+	// Callbacks are run after the event has been handled,
+	// so the check is done in JavaScript.
+	// Shortcuts with modifiers are always left to the browser.
+	preventKeys = Global.Get("Set").New()
+	prevent := Global.Get("Function").New("keys", `return function(ev) {
+		if (keys.has(ev.code) && !ev.ctrlKey && !ev.metaKey && !ev.altKey) {
+			ev.preventDefault();
+		}
+	}`).Invoke(preventKeys)
+	canvas.Call("addEventListener", "keydown", prevent)
+	canvas.Call("addEventListener", "keydown", newCallback(func(args []jsObject) {
+		keys.keyDown(browserKeys[args[0].Get("code").String()])
+	}))
+	canvas.Call("addEventListener", "keyup", newCallback(func(args []jsObject) {
+		keys.keyUp(browserKeys[args[0].Get("code").String()])
+	}))
+	canvas.Call("addEventListener", "blur", newCallback(func(args []jsObject) {
+		keys.releaseAll()
+	}))
+
+	// The canvas may be scaled by CSS.
+	move := func(ev jsObject, inside bool) {
+		x := ev.Get("offsetX").Float() * float64(renderWidth) / canvas.Get("clientWidth").Float()
+		y := ev.Get("offsetY").Float() * float64(renderHeight) / canvas.Get("clientHeight").Float()
+		keys.mouseMove(x, y, inside)
+	}
+	canvas.Call("addEventListener", "mousemove", newCallback(func(args []jsObject) {
+		move(args[0], true)
+	}))
+	canvas.Call("addEventListener", "mouseleave", newCallback(func(args []jsObject) {
+		move(args[0], false)
+	}))
+	canvas.Call("addEventListener", "mousedown", newCallback(func(args []jsObject) {
+		keys.button(browserButton(args[0]), true)
+	}))
+	canvas.Call("addEventListener", "mouseup", newCallback(func(args []jsObject) {
+		keys.button(browserButton(args[0]), false)
+	}))
+	canvas.Call("addEventListener", "contextmenu", js.NewEventCallback(js.PreventDefault, func(ev jsObject) {}))
+	canvas.Call("addEventListener", "wheel", js.NewEventCallback(js.PreventDefault, func(ev jsObject) {
+		// Pixel deltas are about 100 per step.
+		div := 1.0
+		if ev.Get("deltaMode").Int() == 0 {
+			div = 100
+		}
+		keys.wheel(-ev.Get("deltaX").Float()/div, -ev.Get("deltaY").Float()/div)
+	}))
+	canvas.Call("focus")
+}
+
+// usedKeys updates the keys whose default action is prevented
+// to the keys read by the bindings, the panel and the effect in a frame.
+func usedKeys(read *[numKeys]bool) {
+	for code, k := range browserKeys {
+		if read[k] == prevented[k] {
+			continue
+		}
+		if read[k] {
+			preventKeys.Call("add", code)
+		} else {
+			preventKeys.Call("delete", code)
+		}
+	}
+	prevented = *read
+}
+
+// browserButton returns the button of a mouse event.
+func browserButton(ev jsObject) MouseButton {
+	switch ev.Get("button").Int() {
+	case 0:
+		return MouseLeft
+	case 1:
+		return MouseMiddle
+	case 2:
+		return MouseRight
+	}
+	return numButtons
+}
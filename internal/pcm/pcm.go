@@ -0,0 +1,69 @@
+// Package pcm renders music offline.
+package pcm
+
+// MaxSeconds limits offline rendering of music that never ends.
+// With wasm the rendered music is kept in memory, so this is kept short.
+const MaxSeconds = 10 * 60
+
+// RenderFunc renders stereo samples into buf and returns the number of samples.
+// Fewer than len(buf) samples are returned when the music ends.
+type RenderFunc func(buf [][2]float64) int
+
+// Each renders until the music ends, or MaxSeconds of music has been rendered,
+// and calls fn with each block of samples.
+func Each(render RenderFunc, sampleRate int, fn func(block [][2]float64)) {
+	EachN(render, sampleRate*MaxSeconds, fn)
+}
+
+// EachN renders until the music ends, or n samples have been rendered,
+// and calls fn with each block of samples.
+func EachN(render RenderFunc, n int, fn func(block [][2]float64)) {
+	buf := make([][2]float64, 4096)
+	for left := n; left > 0; {
+		if left < len(buf) {
+			buf = buf[:left]
+		}
+		n := render(buf)
+		fn(buf[:n])
+		left -= n
+		if n < len(buf) {
+			break
+		}
+	}
+}
+
+// All returns the samples rendered by Each.
+func All(render RenderFunc, sampleRate int) [][2]float64 {
+	return First(render, sampleRate*MaxSeconds)
+}
+
+// First returns the samples rendered by EachN.
+func First(render RenderFunc, n int) [][2]float64 {
+	var res [][2]float64
+	EachN(render, n, func(block [][2]float64) {
+		res = append(res, block...)
+	})
+	return res
+}
+
+// Int16 returns the samples rendered by Each as interleaved 16 bit stereo.
+func Int16(render RenderFunc, sampleRate int) []int16 {
+	var res []int16
+	Each(render, sampleRate, func(block [][2]float64) {
+		for _, s := range block {
+			res = append(res, ToInt16(s[0]), ToInt16(s[1]))
+		}
+	})
+	return res
+}
+
+// ToInt16 converts a sample to 16 bits, clamping it to -1 -> 1.
+func ToInt16(v float64) int16 {
+	switch {
+	case v < -1:
+		v = -1
+	case v > 1:
+		v = 1
+	}
+	return int16(v * 32767)
+}
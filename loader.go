@@ -1,26 +1,153 @@
 package gfx
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 )
 
 type LoadFn func(name string) ([]byte, error)
 
-var loaders []LoadFn
+// Source is a named data source.
+type Source struct {
+	// Name of the source, used when reporting errors.
+	// If empty, a name is generated.
+	Name string
 
-// AddData will add a data loader.
-func AddData(fn LoadFn) {
-	loaders = append(loaders, fn)
+	// Prefix will make the source only handle files with this prefix.
+	// The prefix is removed from the name before it is sent to the loader.
+	Prefix string
+
+	// Priority of the source. Sources with higher priority are tried first.
+	// Sources with the same priority are tried in the order they were added.
+	Priority int
+
+	Fn LoadFn
 }
 
-func Load(file string) ([]byte, error) {
-	for i, fn := range loaders {
-		b, err := fn(file)
+// Logger receives messages from a Loader.
+// *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Loader will load data from a list of sources.
+type Loader struct {
+	// Log will receive failures of individual sources.
+	// If nil, nothing is logged.
+	Log Logger
+
+	mu      sync.RWMutex
+	sources []Source
+}
+
+// NewLoader returns a loader without any sources.
+func NewLoader() *Loader {
+	return &Loader{}
+}
+
+// DefaultLoader is used by AddData and Load.
+var DefaultLoader = &Loader{Log: log.New(os.Stdout, "", 0)}
+
+// Add a source to the loader.
+func (l *Loader) Add(s Source) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("loader %d", len(l.sources))
+	}
+	// Copy, so running loads are unaffected.
+	sources := append(make([]Source, 0, len(l.sources)+1), l.sources...)
+	sources = append(sources, s)
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Priority > sources[j].Priority
+	})
+	l.sources = sources
+}
+
+// AddFn adds an unnamed loader with priority 0 and no prefix.
+func (l *Loader) AddFn(fn LoadFn) {
+	l.Add(Source{Fn: fn})
+}
+
+// Load the file from the first source that returns it.
+// If no sources return the file a *LoadError is returned.
+func (l *Loader) Load(file string) ([]byte, error) {
+	l.mu.RLock()
+	sources := l.sources
+	l.mu.RUnlock()
+	lErr := LoadError{File: file}
+	for _, s := range sources {
+		if !strings.HasPrefix(file, s.Prefix) {
+			continue
+		}
+		b, err := s.Fn(strings.TrimPrefix(file, s.Prefix))
 		if err == nil {
 			return b, nil
 		}
-		fmt.Println("Loader", i, "returned", err.Error())
+		if l.Log != nil {
+			l.Log.Printf("Loader %q returned %v", s.Name, err)
+		}
+		lErr.Errs = append(lErr.Errs, SourceError{Source: s.Name, Err: err})
+	}
+	return nil, &lErr
+}
+
+// SourceError is the error returned by a single source.
+type SourceError struct {
+	Source string
+	Err    error
+}
+
+// LoadError is returned when no source was able to load a file.
+// It matches os.ErrNotExist when checked with errors.Is,
+// if the file did not exist in any source.
+type LoadError struct {
+	File string
+	// Errs contains the errors of all sources that were tried.
+	Errs []SourceError
+}
+
+func (e *LoadError) Error() string {
+	if len(e.Errs) == 0 {
+		return fmt.Sprintf("%s: no source for file", e.File)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: not found in %d sources", e.File, len(e.Errs))
+	for _, err := range e.Errs {
+		fmt.Fprintf(&sb, "; %s: %v", err.Source, err.Err)
+	}
+	return sb.String()
+}
+
+func (e *LoadError) Is(target error) bool {
+	if target != os.ErrNotExist {
+		return false
+	}
+	for _, err := range e.Errs {
+		if !isNotExist(err.Err) {
+			return false
+		}
 	}
-	return nil, os.ErrNotExist
+	return true
+}
+
+// isNotExist returns whether err means that a file does not exist.
+// Wrapped errors are checked as well.
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// AddData will add a data loader to the default loader.
+func AddData(fn LoadFn) {
+	DefaultLoader.AddFn(fn)
+}
+
+// Load will load a file using the default loader.
+func Load(file string) ([]byte, error) {
+	return DefaultLoader.Load(file)
 }
@@ -0,0 +1,34 @@
+package gfx
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// FSLoader returns a loader that reads files from fsys.
+// This can be used with embed.FS, os.DirFS, zip.Reader, etc.
+// Names are cleaned and leading slashes are removed,
+// since fs.FS does not accept rooted paths.
+func FSLoader(fsys fs.FS) LoadFn {
+	return func(name string) ([]byte, error) {
+		name = strings.TrimPrefix(path.Clean("/"+strings.Replace(name, "\\", "/", -1)), "/")
+		return fs.ReadFile(fsys, name)
+	}
+}
+
+// DirLoader returns a loader that reads files from a directory on disk.
+func DirLoader(dir string) LoadFn {
+	return FSLoader(os.DirFS(dir))
+}
+
+// AddFS adds a file system as a source.
+func (l *Loader) AddFS(name string, fsys fs.FS) {
+	l.Add(Source{Name: name, Fn: FSLoader(fsys)})
+}
+
+// AddFS will add a file system to the default loader.
+func AddFS(fsys fs.FS) {
+	DefaultLoader.AddFn(FSLoader(fsys))
+}
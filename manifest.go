@@ -0,0 +1,191 @@
+package gfx
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// AssetKind is the type of an asset in a manifest.
+type AssetKind int
+
+const (
+	// AssetData is raw data, see Cache.Data.
+	AssetData AssetKind = iota
+	// AssetGreyPicture is a grey picture, see Cache.GreyPicture.
+	AssetGreyPicture
+	// AssetPalPicture is a paletted picture, see Cache.PalPicture.
+	AssetPalPicture
+	// AssetPalette is a palette, see Cache.Palette.
+	AssetPalette
+	// AssetAnimation is an animation, see Cache.Animation.
+	AssetAnimation
+)
+
+// ManifestEntry is a single asset to preload.
+type ManifestEntry struct {
+	Kind AssetKind
+	Path string
+}
+
+// Manifest is a list of assets to load before effects start.
+// Assets are loaded into a Cache, so effects should get them from the cache.
+type Manifest struct {
+	Entries []ManifestEntry
+
+	// Cache to load assets into. If nil, DefaultCache is used.
+	Cache *Cache
+}
+
+// Add assets of the given kind to the manifest.
+func (m *Manifest) Add(kind AssetKind, paths ...string) {
+	for _, p := range paths {
+		m.Entries = append(m.Entries, ManifestEntry{Kind: kind, Path: p})
+	}
+}
+
+func (m *Manifest) load(e ManifestEntry) error {
+	c := m.Cache
+	if c == nil {
+		c = DefaultCache
+	}
+	var err error
+	switch e.Kind {
+	case AssetData:
+		_, err = c.Data(e.Path)
+	case AssetGreyPicture:
+		_, err = c.GreyPicture(e.Path)
+	case AssetPalPicture:
+		_, err = c.PalPicture(e.Path)
+	case AssetPalette:
+		_, err = c.Palette(e.Path)
+	case AssetAnimation:
+		_, err = c.Animation(e.Path)
+	default:
+		err = fmt.Errorf("unknown asset kind %d", e.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", e.Path, err)
+	}
+	return nil
+}
+
+// Load all assets in parallel.
+// progress is called every time an asset has been loaded,
+// and is never called concurrently.
+// The first error encountered is returned.
+func (m *Manifest) Load(progress func(done, total int)) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     int
+		entries  = make(chan ManifestEntry)
+	)
+	workers := runtime.NumCPU()
+	if workers > len(m.Entries) {
+		workers = len(m.Entries)
+	}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for e := range entries {
+				err := m.load(e)
+				mu.Lock()
+				done++
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if progress != nil {
+					progress(done, len(m.Entries))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, e := range m.Entries {
+		entries <- e
+	}
+	close(entries)
+	wg.Wait()
+	return firstErr
+}
+
+var (
+	preloadMu sync.Mutex
+	preload   *Manifest
+)
+
+// Preload sets a manifest that is loaded before effects are started.
+// The runners show the progress while loading.
+func Preload(m *Manifest) {
+	preloadMu.Lock()
+	preload = m
+	preloadMu.Unlock()
+}
+
+// startPreload will start loading the preload manifest.
+// The returned channel receives the progress and is closed when loading is done.
+// The error is available when the channel is closed.
+// If there is nothing to load, nil is returned.
+func startPreload() (progress <-chan [2]int, err *error) {
+	preloadMu.Lock()
+	m := preload
+	preload = nil
+	preloadMu.Unlock()
+	if m == nil || len(m.Entries) == 0 {
+		return nil, nil
+	}
+	ch := make(chan [2]int, 1)
+	err = new(error)
+	go func() {
+		defer close(ch)
+		*err = m.Load(func(done, total int) {
+			// Only keep the latest progress.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- [2]int{done, total}
+		})
+	}()
+	return ch, err
+}
+
+// progressImage returns an image with a progress bar.
+func progressImage(done, total int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, renderWidth, renderHeight))
+	w, h := renderWidth/2, renderHeight/30
+	if h < 4 {
+		h = 4
+	}
+	x0, y0 := (renderWidth-w)/2, (renderHeight-h)/2
+	filled := 0
+	if total > 0 {
+		filled = w * done / total
+	}
+	// The frame is clipped on small render sizes.
+	bar := image.Rect(x0, y0, x0+w, y0+h)
+	frame := bar.Inset(-2).Intersect(img.Rect)
+	for y := frame.Min.Y; y < frame.Max.Y; y++ {
+		for x := frame.Min.X; x < frame.Max.X; x++ {
+			// Frame, filled part and background.
+			v := uint8(0x30)
+			switch {
+			case !image.Pt(x, y).In(bar):
+				v = 0xc0
+			case x-x0 < filled:
+				v = 0xff
+			}
+			p := img.Pix[img.PixOffset(x, y):]
+			p[0], p[1], p[2], p[3] = v, v, v, 0xff
+		}
+	}
+	// Make the rest opaque black.
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
@@ -0,0 +1,89 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// frameView is an output frame of a runner as a draw.Image,
+// so overlays can be drawn on it. 0,0 is the top left.
+type frameView struct {
+	rect image.Rectangle
+	get  func(x, y int) color.RGBA
+	put  func(x, y int, c color.RGBA)
+}
+
+func (f *frameView) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (f *frameView) Bounds() image.Rectangle {
+	return f.rect
+}
+
+func (f *frameView) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(f.rect) {
+		return color.RGBA{}
+	}
+	return f.get(x, y)
+}
+
+func (f *frameView) Set(x, y int, c color.Color) {
+	if image.Pt(x, y).In(f.rect) {
+		f.put(x, y, color.RGBAModel.Convert(c).(color.RGBA))
+	}
+}
+
+// rgbaView returns a view of RGBA pixels stored in rows from the top.
+func rgbaView(pix []byte, w, h int) *frameView {
+	return &frameView{
+		rect: image.Rect(0, 0, w, h),
+		get: func(x, y int) color.RGBA {
+			p := pix[(y*w+x)*4:]
+			return color.RGBA{R: p[0], G: p[1], B: p[2], A: p[3]}
+		},
+		put: func(x, y int, c color.RGBA) {
+			p := pix[(y*w+x)*4:]
+			p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+		},
+	}
+}
+
+// Size of the overlay font.
+const (
+	fontWidth  = 7
+	fontHeight = 13
+)
+
+// drawText draws s in the built-in font with the top left corner at x, y.
+// The end of the text is returned.
+func drawText(dst draw.Image, x, y int, s string, c color.Color) int {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y+basicfont.Face7x13.Ascent),
+	}
+	d.DrawString(s)
+	return d.Dot.X.Round()
+}
+
+// fillRect blends c over r.
+func fillRect(dst draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(dst, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// Overlay colours.
+var (
+	overlayBG     = color.RGBA{A: 176}
+	overlayText   = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	overlayDim    = color.RGBA{R: 150, G: 150, B: 150, A: 255}
+	overlayAccent = color.RGBA{R: 80, G: 200, B: 80, A: 255}
+	overlaySelect = color.RGBA{R: 40, G: 80, B: 40, A: 160}
+	overlayWarn   = color.RGBA{R: 230, G: 60, B: 60, A: 255}
+)
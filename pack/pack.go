@@ -0,0 +1,292 @@
+// Package pack reads and writes compressed archives of demo data.
+//
+// A pack consists of a header, the file data and an index followed by a trailer.
+// Every file is compressed individually, so files can be read in random order.
+// Everything between the header and the trailer can be obfuscated with a key.
+//
+// A pack can be used as data source:
+//
+//	p, err := pack.OpenFile("demo.pak", nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	gfx.AddData(p.ReadFile)
+package pack
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Method is the compression method of an entry.
+type Method uint8
+
+const (
+	Store Method = iota
+	Deflate
+	Zstd
+)
+
+func (m Method) String() string {
+	switch m {
+	case Store:
+		return "store"
+	case Deflate:
+		return "deflate"
+	case Zstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("method(%d)", uint8(m))
+}
+
+const (
+	magic       = "GFXPACK\x01"
+	headerSize  = len(magic) + 1 + 4
+	trailerSize = 8 + 4 + 4
+	trailer     = "GFXP"
+
+	flagObfuscated = 1
+
+	// maxRatio is the largest compression ratio accepted in the index.
+	// It is above what Deflate and Zstd can reach on real data.
+	maxRatio = 1 << 15
+
+	// maxPrealloc is the largest output buffer allocated from the size in the index.
+	// Larger files grow the buffer while decompressing.
+	maxPrealloc = 1 << 20
+)
+
+var (
+	// ErrFormat is returned when the input isn't a valid pack.
+	ErrFormat = errors.New("pack: invalid format")
+	// ErrKey is returned when the obfuscation key doesn't match the pack.
+	ErrKey = errors.New("pack: wrong key")
+)
+
+type entry struct {
+	method Method
+	offset int64
+	csize  int64
+	size   int64
+	crc    uint32
+}
+
+// Pack is an opened pack file.
+// It is safe for concurrent use.
+type Pack struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	key     []byte
+	entries map[string]entry
+}
+
+// keyCheck returns a value stored in the header to validate the key.
+func keyCheck(key []byte) uint32 {
+	return crc32.ChecksumIEEE(key)
+}
+
+// xor will obfuscate or deobfuscate b, which is at offset off in the pack.
+func xor(b, key []byte, off int64) {
+	if len(key) == 0 {
+		return
+	}
+	k := int(off % int64(len(key)))
+	for i := range b {
+		b[i] ^= key[k]
+		k++
+		if k == len(key) {
+			k = 0
+		}
+	}
+}
+
+// Open a pack with the size from r.
+// The key must match the key used when writing the pack.
+func Open(r io.ReaderAt, size int64, key []byte) (*Pack, error) {
+	if size < int64(headerSize+trailerSize) {
+		return nil, ErrFormat
+	}
+	var hdr [headerSize]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	obfuscated := hdr[len(magic)]&flagObfuscated != 0
+	if obfuscated != (len(key) > 0) || binary.LittleEndian.Uint32(hdr[len(magic)+1:]) != keyCheck(key) {
+		return nil, ErrKey
+	}
+
+	var tr [trailerSize]byte
+	if _, err := r.ReadAt(tr[:], size-trailerSize); err != nil {
+		return nil, err
+	}
+	if string(tr[12:]) != trailer {
+		return nil, ErrFormat
+	}
+	idxOff := int64(binary.LittleEndian.Uint64(tr[:8]))
+	idxLen := int64(binary.LittleEndian.Uint32(tr[8:12]))
+	if idxOff < int64(headerSize) || idxOff+idxLen > size-trailerSize {
+		return nil, ErrFormat
+	}
+	idx := make([]byte, idxLen)
+	if _, err := r.ReadAt(idx, idxOff); err != nil {
+		return nil, err
+	}
+	xor(idx, key, idxOff)
+
+	p := Pack{r: r, key: key, entries: make(map[string]entry)}
+	br := bytes.NewReader(idx)
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, ErrFormat
+	}
+	for i := uint64(0); i < n; i++ {
+		var vals [5]uint64
+		for j := range vals {
+			vals[j], err = binary.ReadUvarint(br)
+			if err != nil {
+				return nil, ErrFormat
+			}
+		}
+		nameLen, method, offset, csize, size := vals[0], vals[1], vals[2], vals[3], vals[4]
+		if nameLen > uint64(br.Len()) {
+			return nil, ErrFormat
+		}
+		name := make([]byte, nameLen)
+		io.ReadFull(br, name)
+		var crc [4]byte
+		if _, err := io.ReadFull(br, crc[:]); err != nil {
+			return nil, ErrFormat
+		}
+		if csize > uint64(idxOff) || offset > uint64(idxOff)-csize {
+			return nil, ErrFormat
+		}
+		if Method(method) == Store && size != csize || size > csize*maxRatio {
+			return nil, ErrFormat
+		}
+		p.entries[string(name)] = entry{
+			method: Method(method),
+			offset: int64(offset),
+			csize:  int64(csize),
+			size:   int64(size),
+			crc:    binary.LittleEndian.Uint32(crc[:]),
+		}
+	}
+	return &p, nil
+}
+
+// OpenFile opens a pack file on disk.
+// Close should be called when the pack is no longer used.
+func OpenFile(name string, key []byte) (*Pack, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p, err := Open(f, st.Size(), key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p.closer = f
+	return p, nil
+}
+
+// Close the underlying file if opened with OpenFile.
+func (p *Pack) Close() error {
+	if p.closer != nil {
+		return p.closer.Close()
+	}
+	return nil
+}
+
+// Names returns the sorted names of all files in the pack.
+func (p *Pack) Names() []string {
+	names := make([]string, 0, len(p.entries))
+	for name := range p.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	zDec     *zstd.Decoder
+	zDecErr  error
+	zDecOnce sync.Once
+)
+
+// ReadFile returns the decompressed content of a file.
+// The signature matches gfx.LoadFn.
+func (p *Pack) ReadFile(name string) ([]byte, error) {
+	name = cleanName(name)
+	e, ok := p.entries[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	src := make([]byte, e.csize)
+	if _, err := p.r.ReadAt(src, e.offset); err != nil {
+		return nil, err
+	}
+	xor(src, p.key, e.offset)
+	prealloc := e.size
+	if prealloc > maxPrealloc {
+		prealloc = maxPrealloc
+	}
+	var dst []byte
+	switch e.method {
+	case Store:
+		dst = src
+	case Deflate:
+		buf := bytes.NewBuffer(make([]byte, 0, prealloc))
+		r := flate.NewReader(bytes.NewReader(src))
+		// Read one byte more than the size, so longer output fails the size check.
+		_, err := io.Copy(buf, io.LimitReader(r, e.size+1))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("pack: %s: %v", name, err)
+		}
+		dst = buf.Bytes()
+	case Zstd:
+		zDecOnce.Do(func() {
+			zDec, zDecErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		})
+		if zDecErr != nil {
+			return nil, fmt.Errorf("pack: %s: %v", name, zDecErr)
+		}
+		var err error
+		dst, err = zDec.DecodeAll(src, make([]byte, 0, prealloc))
+		if err != nil {
+			return nil, fmt.Errorf("pack: %s: %v", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("pack: %s: unknown method %v", name, e.method)
+	}
+	if int64(len(dst)) != e.size || crc32.ChecksumIEEE(dst) != e.crc {
+		return nil, fmt.Errorf("pack: %s: checksum mismatch", name)
+	}
+	return dst, nil
+}
+
+// cleanName returns the name as stored in the index.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.Replace(name, "\\", "/", -1)), "/")
+}
@@ -0,0 +1,146 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testFiles are written to packs in tests, with the method used to add them.
+var testFiles = []struct {
+	name   string
+	data   []byte
+	method Method
+}{
+	{"music/song.xm", bytes.Repeat([]byte("compressible "), 1000), Zstd},
+	{"gfx/logo.png", bytes.Repeat([]byte("deflated "), 1000), Deflate},
+	{"short.txt", []byte("hi"), Store},
+	{"empty", nil, Zstd},
+}
+
+// testPack returns a pack with testFiles.
+// If edit is not nil, it is called before the index is written.
+func testPack(t *testing.T, key []byte, edit func(w *Writer)) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range testFiles {
+		m, err := w.Add(f.name, f.data, f.method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Files that don't compress are stored.
+		want := f.method
+		if len(f.data) < 10 {
+			want = Store
+		}
+		if m != want {
+			t.Errorf("%s: added with %v, want %v", f.name, m, want)
+		}
+	}
+	if edit != nil {
+		edit(w)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("secret")} {
+		b := testPack(t, key, nil)
+		if len(key) > 0 && bytes.Contains(b, []byte("compressible")) {
+			t.Error("obfuscated pack contains plain text")
+		}
+		p, err := Open(bytes.NewReader(b), int64(len(b)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"empty", "gfx/logo.png", "music/song.xm", "short.txt"}
+		if got := p.Names(); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got names %v, want %v", got, want)
+		}
+		for _, f := range testFiles {
+			got, err := p.ReadFile(f.name)
+			if err != nil {
+				t.Errorf("%s: %v", f.name, err)
+				continue
+			}
+			if !bytes.Equal(got, f.data) {
+				t.Errorf("%s: content differs", f.name)
+			}
+		}
+		// Names are cleaned like when adding.
+		if _, err := p.ReadFile("/music\\song.xm"); err != nil {
+			t.Error(err)
+		}
+		if _, err := p.ReadFile("missing"); err == nil {
+			t.Error("missing file: no error")
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	b := testPack(t, []byte("secret"), nil)
+	for _, key := range [][]byte{nil, []byte("wrong")} {
+		if _, err := Open(bytes.NewReader(b), int64(len(b)), key); err != ErrKey {
+			t.Errorf("key %q: got %v, want %v", key, err, ErrKey)
+		}
+	}
+	b = testPack(t, nil, nil)
+	if _, err := Open(bytes.NewReader(b), int64(len(b)), []byte("secret")); err != ErrKey {
+		t.Errorf("key on plain pack: got %v, want %v", err, ErrKey)
+	}
+}
+
+func TestCorruptIndex(t *testing.T) {
+	b := testPack(t, nil, nil)
+	tr := len(b) - trailerSize
+	idxOff := binary.LittleEndian.Uint64(b[tr:])
+	idxLen := binary.LittleEndian.Uint32(b[tr+8:])
+
+	for name, edit := range map[string]func(b []byte){
+		"index past end":  func(b []byte) { binary.LittleEndian.PutUint32(b[tr+8:], idxLen+1) },
+		"index in header": func(b []byte) { binary.LittleEndian.PutUint64(b[tr:], 1) },
+		"short index":     func(b []byte) { binary.LittleEndian.PutUint32(b[tr+8:], idxLen/2) },
+		"entry count":     func(b []byte) { b[idxOff] = 0x7f },
+		"trailer":         func(b []byte) { b[len(b)-1] = 'X' },
+	} {
+		c := append([]byte(nil), b...)
+		edit(c)
+		if _, err := Open(bytes.NewReader(c), int64(len(c)), nil); err != ErrFormat {
+			t.Errorf("%s: got %v, want %v", name, err, ErrFormat)
+		}
+	}
+
+	// A size above the compression limit is rejected when opening.
+	c := testPack(t, nil, func(w *Writer) {
+		e := w.entries["music/song.xm"]
+		e.size = e.csize*maxRatio + 1
+		w.entries["music/song.xm"] = e
+	})
+	if _, err := Open(bytes.NewReader(c), int64(len(c)), nil); err != ErrFormat {
+		t.Errorf("huge size: got %v, want %v", err, ErrFormat)
+	}
+
+	// Sizes within the limit must match the decompressed data.
+	for _, name := range []string{"music/song.xm", "gfx/logo.png"} {
+		c := testPack(t, nil, func(w *Writer) {
+			e := w.entries[name]
+			e.size = e.csize * maxRatio
+			w.entries[name] = e
+		})
+		p, err := Open(bytes.NewReader(c), int64(len(c)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.ReadFile(name); err == nil {
+			t.Errorf("%s: wrong size: no error", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package pack
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Writer writes a pack.
+// Close must be called to write the index.
+type Writer struct {
+	w       io.Writer
+	key     []byte
+	off     int64
+	names   []string
+	entries map[string]entry
+	zEnc    *zstd.Encoder
+	closed  bool
+}
+
+// NewWriter returns a writer that writes a pack to w.
+// If key is not empty, the pack content is obfuscated with it.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	var hdr [headerSize]byte
+	copy(hdr[:], magic)
+	if len(key) > 0 {
+		hdr[len(magic)] |= flagObfuscated
+	}
+	binary.LittleEndian.PutUint32(hdr[len(magic)+1:], keyCheck(key))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:       w,
+		key:     append([]byte(nil), key...),
+		off:     int64(headerSize),
+		entries: make(map[string]entry),
+	}, nil
+}
+
+// write obfuscates and writes b. b is modified.
+func (w *Writer) write(b []byte) error {
+	xor(b, w.key, w.off)
+	n, err := w.w.Write(b)
+	w.off += int64(n)
+	return err
+}
+
+// Add a file to the pack.
+// If the compressed size isn't smaller than the input,
+// the file is stored uncompressed.
+// The method used is returned.
+func (w *Writer) Add(name string, data []byte, m Method) (Method, error) {
+	if w.closed {
+		return m, errors.New("pack: writer closed")
+	}
+	name = cleanName(name)
+	if _, ok := w.entries[name]; ok {
+		return m, fmt.Errorf("pack: duplicate name %q", name)
+	}
+	var comp []byte
+	switch m {
+	case Store:
+	case Deflate:
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			return m, err
+		}
+		fw.Write(data)
+		if err := fw.Close(); err != nil {
+			return m, err
+		}
+		comp = buf.Bytes()
+	case Zstd:
+		if w.zEnc == nil {
+			var err error
+			w.zEnc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+			if err != nil {
+				return m, err
+			}
+		}
+		comp = w.zEnc.EncodeAll(data, nil)
+	default:
+		return m, fmt.Errorf("pack: unknown method %v", m)
+	}
+	if m == Store || len(comp) >= len(data) {
+		m = Store
+		comp = append([]byte(nil), data...)
+	}
+	e := entry{
+		method: m,
+		offset: w.off,
+		csize:  int64(len(comp)),
+		size:   int64(len(data)),
+		crc:    crc32.ChecksumIEEE(data),
+	}
+	if err := w.write(comp); err != nil {
+		return m, err
+	}
+	w.names = append(w.names, name)
+	w.entries[name] = e
+	return m, nil
+}
+
+// Close writes the index and trailer.
+// The underlying writer is not closed.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.zEnc != nil {
+		w.zEnc.Close()
+	}
+	var idx []byte
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		idx = append(idx, tmp[:binary.PutUvarint(tmp[:], v)]...)
+	}
+	putUvarint(uint64(len(w.names)))
+	for _, name := range w.names {
+		e := w.entries[name]
+		putUvarint(uint64(len(name)))
+		putUvarint(uint64(e.method))
+		putUvarint(uint64(e.offset))
+		putUvarint(uint64(e.csize))
+		putUvarint(uint64(e.size))
+		idx = append(idx, name...)
+		var crc [4]byte
+		binary.LittleEndian.PutUint32(crc[:], e.crc)
+		idx = append(idx, crc[:]...)
+	}
+	idxOff := w.off
+	if err := w.write(idx); err != nil {
+		return err
+	}
+	var tr [trailerSize]byte
+	binary.LittleEndian.PutUint64(tr[:8], uint64(idxOff))
+	binary.LittleEndian.PutUint32(tr[8:12], uint32(len(idx)))
+	copy(tr[12:], trailer)
+	_, err := w.w.Write(tr[:])
+	return err
+}
+
+// Size returns the number of bytes written so far.
+func (w *Writer) Size() int64 {
+	return w.off
+}
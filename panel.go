@@ -0,0 +1,279 @@
+package gfx
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"time"
+)
+
+// paramRow is a row in the parameter panel.
+// Colours have a row for each channel.
+type paramRow struct {
+	param   int
+	channel int // -1 or 0 -> 2 for red, green and blue.
+}
+
+// paramPanel shows and edits parameters in the preview.
+type paramPanel struct {
+	params *Params
+	rows   []paramRow
+	sel    int
+
+	// drag is the row changed by dragging the mouse, or -1.
+	drag int
+
+	msg   string
+	msgAt time.Time
+}
+
+// Layout of the panel in render coordinates.
+const (
+	panelX       = 4
+	panelY       = 4
+	panelW       = 260
+	panelRowH    = fontHeight + 2
+	panelSliderX = panelX + 130
+	panelSliderW = panelW - 130 - 6
+)
+
+func newParamPanel(p *Params) *paramPanel {
+	pp := &paramPanel{params: p, drag: -1}
+	for i, d := range p.defs {
+		if d.Kind == ParamColor {
+			for c := 0; c < 3; c++ {
+				pp.rows = append(pp.rows, paramRow{param: i, channel: c})
+			}
+			continue
+		}
+		pp.rows = append(pp.rows, paramRow{param: i, channel: -1})
+	}
+	return pp
+}
+
+// bounds returns the area of the panel.
+// There is a title line, the rows and a help line.
+func (pp *paramPanel) bounds() image.Rectangle {
+	return image.Rect(panelX, panelY, panelX+panelW, panelY+(len(pp.rows)+2)*panelRowH+4)
+}
+
+// rowAt returns the row at y, or -1.
+func (pp *paramPanel) rowAt(y int) int {
+	y -= panelY + 2 + panelRowH
+	if y < 0 || y/panelRowH >= len(pp.rows) {
+		return -1
+	}
+	return y / panelRowH
+}
+
+// value returns the value of a row and its range.
+func (pp *paramPanel) value(r paramRow) (v, lo, hi float64) {
+	if r.channel >= 0 {
+		c := pp.params.colors[r.param]
+		return float64([3]uint8{c.R, c.G, c.B}[r.channel]), 0, 255
+	}
+	d := pp.params.defs[r.param]
+	return pp.params.values[r.param], d.Min, d.Max
+}
+
+func (pp *paramPanel) setValue(r paramRow, v float64) {
+	if r.channel >= 0 {
+		c := &pp.params.colors[r.param]
+		*[3]*uint8{&c.R, &c.G, &c.B}[r.channel] = uint8(clampF(math.Round(v), 0, 255))
+		return
+	}
+	pp.params.set(r.param, v)
+}
+
+// step changes the value of a row by n steps.
+// Bools are toggled and choices wrap around.
+func (pp *paramPanel) step(r paramRow, n float64, fine bool) {
+	v, _, _ := pp.value(r)
+	if r.channel >= 0 {
+		s := 8.0
+		if fine {
+			s = 1
+		}
+		pp.setValue(r, v+n*s)
+		return
+	}
+	d := pp.params.defs[r.param]
+	switch d.Kind {
+	case ParamBool:
+		pp.params.values[r.param] = 1 - v
+	case ParamChoice:
+		k := float64(len(d.Choices))
+		if k > 0 {
+			pp.params.values[r.param] = math.Mod(math.Mod(v+math.Round(n), k)+k, k)
+		}
+	default:
+		s := d.Step
+		if s == 0 {
+			s = 1
+			if d.Kind == ParamFloat {
+				s = (d.Max - d.Min) / 100
+			}
+		}
+		if fine && d.Kind == ParamFloat {
+			s /= 10
+		}
+		pp.params.set(r.param, v+n*s)
+	}
+}
+
+// setFromX sets a numeric row from a mouse position on the slider.
+func (pp *paramPanel) setFromX(r paramRow, x int) {
+	_, lo, hi := pp.value(r)
+	f := clampF(float64(x-panelSliderX)/panelSliderW, 0, 1)
+	pp.setValue(r, lo+f*(hi-lo))
+}
+
+func (pp *paramPanel) numeric(r paramRow) bool {
+	k := pp.params.defs[r.param].Kind
+	return r.channel >= 0 || k == ParamFloat || k == ParamInt
+}
+
+// panelKeys are the keys used by the panel while it is shown.
+var panelKeys = []Key{KeyUp, KeyDown, KeyLeft, KeyRight, KeyR, KeyS, KeyL}
+
+// handle edits the parameters with the input.
+// Keys and mouse input used by the panel are removed from in.
+func (pp *paramPanel) handle(in *Input) {
+	if len(pp.rows) == 0 {
+		return
+	}
+	cur := pp.rows[pp.sel]
+	switch {
+	case in.JustPressed(KeyUp):
+		pp.sel = (pp.sel + len(pp.rows) - 1) % len(pp.rows)
+	case in.JustPressed(KeyDown):
+		pp.sel = (pp.sel + 1) % len(pp.rows)
+	case in.JustPressed(KeyLeft):
+		pp.step(cur, -1, in.Shift())
+	case in.JustPressed(KeyRight):
+		pp.step(cur, 1, in.Shift())
+	case in.JustPressed(KeyR):
+		pp.params.reset(cur.param)
+	case in.JustPressed(KeyS):
+		pp.message(pp.save(), savedText(ParamPreset))
+	case in.JustPressed(KeyL):
+		pp.message(pp.params.LoadPreset(ParamPreset), "Loaded "+ParamPreset)
+	}
+	for _, k := range panelKeys {
+		in.consumeKey(k)
+	}
+
+	if pp.drag >= 0 {
+		if in.ButtonDown(MouseLeft) {
+			pp.setFromX(pp.rows[pp.drag], in.Mouse.X)
+		} else {
+			pp.drag = -1
+		}
+		in.consumeMouse()
+		return
+	}
+	if !in.MouseInside || !in.Mouse.In(pp.bounds()) {
+		return
+	}
+	if i := pp.rowAt(in.Mouse.Y); i >= 0 {
+		r := pp.rows[i]
+		switch {
+		case in.ButtonPressed(MouseLeft):
+			pp.sel = i
+			if !pp.numeric(r) {
+				pp.step(r, 1, false)
+			} else if in.Mouse.X >= panelSliderX {
+				pp.drag = i
+				pp.setFromX(r, in.Mouse.X)
+			}
+		case in.ButtonPressed(MouseRight):
+			pp.sel = i
+			pp.step(r, -1, false)
+		case in.WheelY != 0:
+			pp.sel = i
+			pp.step(r, in.WheelY, in.Shift())
+		}
+	}
+	in.consumeMouse()
+}
+
+// save the parameters to ParamPreset.
+func (pp *paramPanel) save() error {
+	b, err := pp.params.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return saveFile(ParamPreset, b)
+}
+
+// message shows the result of an operation.
+func (pp *paramPanel) message(err error, ok string) {
+	pp.msg, pp.msgAt = ok, time.Now()
+	if err != nil {
+		pp.msg = err.Error()
+	}
+	fmt.Println(pp.msg)
+}
+
+// draw the panel on dst.
+func (pp *paramPanel) draw(dst draw.Image) {
+	fillRect(dst, pp.bounds(), overlayBG)
+	y := panelY + 2
+	drawText(dst, panelX+4, y, "Parameters", overlayAccent)
+	y += panelRowH
+	for i, r := range pp.rows {
+		d := pp.params.defs[r.param]
+		if i == pp.sel {
+			fillRect(dst, image.Rect(panelX, y, panelX+panelW, y+panelRowH), overlaySelect)
+		}
+		name := d.Name
+		if r.channel >= 0 {
+			name += [3]string{" R", " G", " B"}[r.channel]
+		}
+		if n := (panelSliderX - panelX - 8) / fontWidth; len(name) > n {
+			name = name[:n]
+		}
+		drawText(dst, panelX+4, y+1, name, overlayText)
+
+		v, lo, hi := pp.value(r)
+		var s string
+		switch {
+		case r.channel >= 0:
+			s = fmt.Sprint(v)
+			if r.channel == 0 {
+				// Show the colour left of the sliders.
+				sw := image.Rect(panelSliderX-14, y+2, panelSliderX-4, y+panelRowH-2)
+				fillRect(dst, sw, pp.params.colors[r.param])
+			}
+		case d.Kind == ParamFloat:
+			s = fmt.Sprintf("%.4g", v)
+		case d.Kind == ParamInt:
+			s = fmt.Sprint(int(v))
+		case d.Kind == ParamBool:
+			s = "off"
+			if v != 0 {
+				s = "on"
+			}
+		case d.Kind == ParamChoice:
+			if int(v) < len(d.Choices) {
+				s = d.Choices[int(v)]
+			}
+		}
+		if pp.numeric(r) {
+			track := image.Rect(panelSliderX, y+2, panelSliderX+panelSliderW, y+panelRowH-2)
+			fillRect(dst, track, overlayBG)
+			if hi > lo {
+				track.Max.X = track.Min.X + int(float64(panelSliderW)*(v-lo)/(hi-lo))
+				fillRect(dst, track, overlaySelect)
+			}
+		}
+		drawText(dst, panelSliderX+4, y+1, s, overlayText)
+		y += panelRowH
+	}
+	help := "Arrows, R reset, S save, L load"
+	if time.Since(pp.msgAt) < 3*time.Second {
+		help = pp.msg
+	}
+	drawText(dst, panelX+4, y+1, help, overlayDim)
+}
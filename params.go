@@ -0,0 +1,295 @@
+package gfx
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// ParamKind is the type of a Param.
+type ParamKind int
+
+const (
+	ParamFloat ParamKind = iota
+	ParamInt
+	ParamBool
+	ParamColor
+	ParamChoice
+)
+
+// Param is a parameter of a TunableEffect.
+// Use FloatParam, IntParam etc. to create them.
+type Param struct {
+	Name string
+	Kind ParamKind
+
+	// Min and Max is the range of float and int parameters.
+	Min, Max float64
+
+	// Step is the change of float and int parameters for each key press.
+	// If 0, floats use 1/100 of the range and ints use 1.
+	Step float64
+
+	// Choices are the names of the options of a choice parameter, for example palettes.
+	Choices []string
+
+	// Default is the default value of floats and ints, 1 for true bools
+	// and the index of the choice of choice parameters.
+	Default float64
+
+	// DefaultColor is the default value of colour parameters.
+	DefaultColor color.RGBA
+}
+
+// FloatParam returns a float parameter in the range min -> max.
+func FloatParam(name string, def, min, max float64) Param {
+	return Param{Name: name, Kind: ParamFloat, Min: min, Max: max, Default: def}
+}
+
+// IntParam returns an integer parameter in the range min -> max.
+func IntParam(name string, def, min, max int) Param {
+	return Param{Name: name, Kind: ParamInt, Min: float64(min), Max: float64(max), Default: float64(def)}
+}
+
+// BoolParam returns a parameter that is on or off.
+func BoolParam(name string, def bool) Param {
+	p := Param{Name: name, Kind: ParamBool, Max: 1}
+	if def {
+		p.Default = 1
+	}
+	return p
+}
+
+// ColorParam returns a colour parameter.
+func ColorParam(name string, def color.RGBA) Param {
+	return Param{Name: name, Kind: ParamColor, DefaultColor: def}
+}
+
+// ChoiceParam returns a parameter selecting one of the choices.
+// def is the index of the default choice.
+func ChoiceParam(name string, def int, choices ...string) Param {
+	return Param{Name: name, Kind: ParamChoice, Max: float64(len(choices) - 1), Default: float64(def), Choices: choices}
+}
+
+// TunableEffect is an effect with parameters that can be changed in the preview.
+// Params is called once when the runner starts.
+// SetParams is called before every Render with the current values.
+// Presets are loaded from ParamPreset.
+type TunableEffect interface {
+	TimedEffect
+	Params() []Param
+	SetParams(p *Params)
+}
+
+// ParamPreset is the preset the runners load with Load when they start.
+// The parameter panel saves the preset here.
+var ParamPreset = "params.json"
+
+// Params contains the values of parameters.
+type Params struct {
+	defs   []Param
+	values []float64
+	colors []color.RGBA
+	index  map[string]int
+}
+
+// NewParams returns the parameters with default values.
+func NewParams(defs []Param) *Params {
+	p := &Params{
+		defs:   defs,
+		values: make([]float64, len(defs)),
+		colors: make([]color.RGBA, len(defs)),
+		index:  make(map[string]int, len(defs)),
+	}
+	for i, d := range defs {
+		p.index[d.Name] = i
+		p.reset(i)
+	}
+	return p
+}
+
+// reset parameter i to the default value.
+func (p *Params) reset(i int) {
+	p.values[i] = p.defs[i].Default
+	p.colors[i] = p.defs[i].DefaultColor
+}
+
+// set parameter i to v, limited to the range of the parameter.
+func (p *Params) set(i int, v float64) {
+	d := p.defs[i]
+	switch d.Kind {
+	case ParamFloat:
+		v = clampF(v, d.Min, d.Max)
+	case ParamInt, ParamBool, ParamChoice:
+		v = clampF(math.Round(v), d.Min, d.Max)
+	}
+	p.values[i] = v
+}
+
+// Float returns the value of a float parameter.
+// Ints, bools and choices are returned as numbers.
+// Unknown parameters return 0.
+func (p *Params) Float(name string) float64 {
+	i, ok := p.index[name]
+	if !ok {
+		return 0
+	}
+	return p.values[i]
+}
+
+// Int returns the value of an int parameter.
+func (p *Params) Int(name string) int {
+	return int(p.Float(name))
+}
+
+// Bool returns the value of a bool parameter.
+func (p *Params) Bool(name string) bool {
+	return p.Float(name) != 0
+}
+
+// Choice returns the index of the choice of a choice parameter.
+func (p *Params) Choice(name string) int {
+	return int(p.Float(name))
+}
+
+// Color returns the value of a colour parameter.
+func (p *Params) Color(name string) color.RGBA {
+	i, ok := p.index[name]
+	if !ok {
+		return color.RGBA{}
+	}
+	return p.colors[i]
+}
+
+// MarshalJSON returns the values as a JSON object.
+// Colours are stored as "#rrggbb" and choices by name.
+func (p *Params) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.defs))
+	for i, d := range p.defs {
+		v := p.values[i]
+		switch d.Kind {
+		case ParamFloat:
+			m[d.Name] = v
+		case ParamInt:
+			m[d.Name] = int(v)
+		case ParamBool:
+			m[d.Name] = v != 0
+		case ParamColor:
+			c := p.colors[i]
+			m[d.Name] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+		case ParamChoice:
+			if int(v) < len(d.Choices) {
+				m[d.Name] = d.Choices[int(v)]
+			}
+		}
+	}
+	return json.MarshalIndent(m, "", "\t")
+}
+
+// UnmarshalJSON sets the values from a JSON object written by MarshalJSON.
+// Unknown parameters are ignored.
+// If an error is returned, no values are changed.
+func (p *Params) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	// Values are set on a copy, which is applied when all are valid.
+	tmp := *p
+	tmp.values = append([]float64(nil), p.values...)
+	tmp.colors = append([]color.RGBA(nil), p.colors...)
+	if err := tmp.setJSON(m); err != nil {
+		return err
+	}
+	copy(p.values, tmp.values)
+	copy(p.colors, tmp.colors)
+	return nil
+}
+
+// setJSON sets the values from a decoded JSON object.
+func (p *Params) setJSON(m map[string]json.RawMessage) error {
+	for name, raw := range m {
+		i, ok := p.index[name]
+		if !ok {
+			continue
+		}
+		d := p.defs[i]
+		var err error
+		switch d.Kind {
+		case ParamFloat, ParamInt:
+			var v float64
+			if err = json.Unmarshal(raw, &v); err == nil {
+				p.set(i, v)
+			}
+		case ParamBool:
+			var v bool
+			if err = json.Unmarshal(raw, &v); err == nil {
+				p.values[i] = 0
+				if v {
+					p.values[i] = 1
+				}
+			}
+		case ParamColor:
+			var s string
+			var c color.RGBA
+			if err = json.Unmarshal(raw, &s); err == nil {
+				_, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+				c.A = 255
+				p.colors[i] = c
+			}
+		case ParamChoice:
+			var s string
+			if err = json.Unmarshal(raw, &s); err == nil {
+				err = fmt.Errorf("unknown choice %q", s)
+				for j, c := range d.Choices {
+					if c == s {
+						p.values[i], err = float64(j), nil
+					}
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("param %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// LoadPreset loads values saved by the parameter panel using Load.
+// If the preset has an invalid value, no values are changed.
+func (p *Params) LoadPreset(path string) error {
+	b, err := Load(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, p)
+}
+
+// effectParams returns the parameters of a TunableEffect with the preset applied,
+// or nil if the effect has no parameters.
+func effectParams(effect interface{}) *Params {
+	e, ok := effect.(TunableEffect)
+	if !ok {
+		return nil
+	}
+	p := NewParams(e.Params())
+	b, err := Load(ParamPreset)
+	if err != nil {
+		// No preset.
+		return p
+	}
+	if err := json.Unmarshal(b, p); err != nil {
+		fmt.Println("Loading parameters:", err)
+		return p
+	}
+	fmt.Println("Loaded parameters from", ParamPreset)
+	return p
+}
+
+// sendParams gives the parameters to the effect if it is a TunableEffect.
+func sendParams(effect interface{}, p *Params) {
+	if e, ok := effect.(TunableEffect); ok && p != nil {
+		e.SetParams(p)
+	}
+}
@@ -0,0 +1,169 @@
+package gfx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+func init() {
+	image.RegisterFormat("pcx", "\x0a?\x01", decodePCX, decodePCXConfig)
+}
+
+type pcxHeader struct {
+	Manufacturer uint8
+	Version      uint8
+	Encoding     uint8
+	BitsPerPixel uint8
+	XMin, YMin   uint16
+	XMax, YMax   uint16
+	HDpi, VDpi   uint16
+	Colormap     [48]uint8
+	Reserved     uint8
+	Planes       uint8
+	BytesPerLine uint16
+	PaletteInfo  uint16
+	HScreenSize  uint16
+	VScreenSize  uint16
+	Filler       [54]uint8
+}
+
+var errPCX = errors.New("pcx: invalid format")
+
+func readPCXHeader(r io.Reader) (*pcxHeader, error) {
+	var h pcxHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Manufacturer != 0x0a || h.Encoding != 1 || h.XMax < h.XMin || h.YMax < h.YMin {
+		return nil, errPCX
+	}
+	switch {
+	case h.BitsPerPixel == 1 && h.Planes >= 1 && h.Planes <= 4:
+	case h.BitsPerPixel == 8 && (h.Planes == 1 || h.Planes == 3 || h.Planes == 4):
+	default:
+		return nil, fmt.Errorf("pcx: unsupported format, %d bits, %d planes", h.BitsPerPixel, h.Planes)
+	}
+	return &h, nil
+}
+
+func (h *pcxHeader) size() (int, int) {
+	return int(h.XMax-h.XMin) + 1, int(h.YMax-h.YMin) + 1
+}
+
+// headerPalette returns the 16 colour palette stored in the header.
+func (h *pcxHeader) headerPalette() color.Palette {
+	n := 1 << uint(h.Planes)
+	pal := make(color.Palette, n)
+	for i := range pal {
+		pal[i] = color.RGBA{R: h.Colormap[i*3], G: h.Colormap[i*3+1], B: h.Colormap[i*3+2], A: 255}
+	}
+	if n == 2 {
+		// Monochrome images are black and white.
+		pal[0], pal[1] = color.RGBA{A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	return pal
+}
+
+func decodePCXConfig(r io.Reader) (image.Config, error) {
+	h, err := readPCXHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	w, ht := h.size()
+	cfg := image.Config{Width: w, Height: ht, ColorModel: color.RGBAModel}
+	if h.BitsPerPixel == 1 {
+		cfg.ColorModel = h.headerPalette()
+	}
+	return cfg, nil
+}
+
+func decodePCX(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readPCXHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	w, ht := h.size()
+	bpl, planes := int(h.BytesPerLine), int(h.Planes)
+	if bpl*8 < w*int(h.BitsPerPixel) {
+		return nil, errPCX
+	}
+	// Runs may cross lines, so we decode everything at once.
+	// The buffer grows as data is read, so a bogus size fails at the end of the file.
+	size := bpl * planes * ht
+	raw := make([]byte, 0, preallocSize(size))
+	for len(raw) < size {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b < 0xc0 {
+			raw = append(raw, b)
+			continue
+		}
+		v, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		for n := int(b & 0x3f); n > 0 && len(raw) < size; n-- {
+			raw = append(raw, v)
+		}
+	}
+	rect := image.Rect(0, 0, w, ht)
+	switch {
+	case h.BitsPerPixel == 8 && planes == 1:
+		// The 256 colour palette is stored at the end, after a 0x0c marker.
+		rest, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) < 769 || rest[len(rest)-769] != 0x0c {
+			return nil, errors.New("pcx: missing 256 colour palette")
+		}
+		p := rest[len(rest)-768:]
+		pal := make(color.Palette, 256)
+		for i := range pal {
+			pal[i] = color.RGBA{R: p[i*3], G: p[i*3+1], B: p[i*3+2], A: 255}
+		}
+		img := image.NewPaletted(rect, pal)
+		for y := 0; y < ht; y++ {
+			copy(img.Pix[y*img.Stride:y*img.Stride+w], raw[y*bpl:])
+		}
+		return img, nil
+	case h.BitsPerPixel == 8:
+		img := image.NewNRGBA(rect)
+		for y := 0; y < ht; y++ {
+			row := raw[y*bpl*planes:]
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w*4]
+			for x := 0; x < w; x++ {
+				dLine[x*4+3] = 255
+				for p := 0; p < planes; p++ {
+					dLine[x*4+p] = row[p*bpl+x]
+				}
+			}
+		}
+		return img, nil
+	default:
+		img := image.NewPaletted(rect, h.headerPalette())
+		for y := 0; y < ht; y++ {
+			row := raw[y*bpl*planes:]
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w]
+			for x := range dLine {
+				var v uint8
+				for p := 0; p < planes; p++ {
+					if row[p*bpl+x>>3]&(0x80>>uint(x&7)) != 0 {
+						v |= 1 << uint(p)
+					}
+				}
+				dLine[x] = v
+			}
+		}
+		return img, nil
+	}
+}
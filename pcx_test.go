@@ -0,0 +1,73 @@
+package gfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// pcxFile returns a 256 colour PCX file with the RLE data.
+func pcxFile(w, h int, data []byte) []byte {
+	hdr := pcxHeader{
+		Manufacturer: 0x0a,
+		Version:      5,
+		Encoding:     1,
+		BitsPerPixel: 8,
+		XMax:         uint16(w - 1),
+		YMax:         uint16(h - 1),
+		Planes:       1,
+		BytesPerLine: uint16(w + w&1),
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, hdr)
+	b.Write(data)
+	b.WriteByte(0x0c)
+	for i := 0; i < 256; i++ {
+		b.Write([]byte{uint8(i), 255 - uint8(i), 0})
+	}
+	return b.Bytes()
+}
+
+func TestDecodePCX(t *testing.T) {
+	// Row 0 is a run of 7, row 1 is 1, 2, 3 and 0xc5, which must be stored as a run.
+	b := pcxFile(4, 2, []byte{0xc4, 7, 1, 2, 3, 0xc1, 0xc5})
+	img, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := img.(*image.Paletted)
+	if format != "pcx" || !ok {
+		t.Fatalf("got %q, %T", format, img)
+	}
+	if p.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("got bounds %v", p.Bounds())
+	}
+	want := []uint8{7, 7, 7, 7, 1, 2, 3, 0xc5}
+	for i, v := range want {
+		if got := p.ColorIndexAt(i%4, i/4); got != v {
+			t.Errorf("pixel %d,%d: got %d, want %d", i%4, i/4, got, v)
+		}
+	}
+	if p.Palette[7] != (color.RGBA{R: 7, G: 248, A: 255}) {
+		t.Errorf("got colour %v", p.Palette[7])
+	}
+}
+
+func TestDecodePCXCorrupt(t *testing.T) {
+	// The header claims a huge image, but the data ends right away.
+	if _, err := decodePCX(bytes.NewReader(pcxFile(65535, 65535, []byte{0xff, 0}))); err == nil {
+		t.Error("huge: no error")
+	}
+	b := pcxFile(4, 2, []byte{0xc4, 7, 0xc4, 1})
+	for n := 0; n < 128+4; n++ {
+		if _, err := decodePCX(bytes.NewReader(b[:n])); err == nil {
+			t.Errorf("%d bytes: no error", n)
+		}
+	}
+	b[0] = 0
+	if _, err := decodePCX(bytes.NewReader(b)); err != errPCX {
+		t.Errorf("bad header: got %v, want %v", err, errPCX)
+	}
+}
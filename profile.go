@@ -0,0 +1,119 @@
+package gfx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProfileFile is the file ActionProfile writes the frame times to.
+var ProfileFile = "profile.csv"
+
+// ProfileHistory is how long frame times are kept for ActionProfile.
+var ProfileHistory = 10 * time.Second
+
+// prof measures the sections of the frame being rendered.
+// Section 0 is the time outside named sections.
+var prof struct {
+	mu     sync.Mutex
+	active bool
+	start  time.Time
+	cur    int
+	times  []time.Duration
+	names  []string
+	index  map[string]int
+}
+
+// Section starts a named timing section of the frame being rendered.
+// The section lasts until the next call to Section or the end of Render.
+// Sections are shown in the HUD graph and written by ActionProfile.
+// Calls outside the preview runners are ignored.
+func Section(name string) {
+	prof.mu.Lock()
+	defer prof.mu.Unlock()
+	if !prof.active {
+		return
+	}
+	now := time.Now()
+	prof.times[prof.cur] += now.Sub(prof.start)
+	prof.start = now
+	i, ok := prof.index[name]
+	if !ok {
+		if prof.index == nil {
+			prof.index = make(map[string]int)
+		}
+		i = len(prof.names) + 1
+		prof.names = append(prof.names, name)
+		prof.index[name] = i
+		prof.times = append(prof.times, 0)
+	}
+	prof.cur = i
+}
+
+// beginSections starts measuring the sections of a frame.
+func beginSections() {
+	prof.mu.Lock()
+	prof.active, prof.start, prof.cur = true, time.Now(), 0
+	prof.times = make([]time.Duration, len(prof.names)+1)
+	prof.mu.Unlock()
+}
+
+// endSections returns the time spent in each section of the frame.
+func endSections() []time.Duration {
+	prof.mu.Lock()
+	defer prof.mu.Unlock()
+	prof.times[prof.cur] += time.Since(prof.start)
+	prof.active = false
+	return prof.times
+}
+
+// sectionNames returns the names of the sections, starting with section 0.
+func sectionNames() []string {
+	prof.mu.Lock()
+	defer prof.mu.Unlock()
+	return append([]string{"other"}, prof.names...)
+}
+
+// profileCSV returns the frames in the history as CSV.
+// There is a row per frame with times in milliseconds.
+func profileCSV(s *frameStats) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	names := sectionNames()
+	w.Write(append([]string{"seconds", "time", "frame_ms"}, names...))
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+	}
+	var first time.Time
+	if len(s.history) > 0 {
+		first = s.history[0].at
+	}
+	for _, r := range s.history {
+		row := []string{
+			fmt.Sprintf("%.3f", r.at.Sub(first).Seconds()),
+			fmt.Sprintf("%.4f", r.t),
+			ms(r.total),
+		}
+		for i := range names {
+			var d time.Duration
+			if i < len(r.sections) {
+				d = r.sections[i]
+			}
+			row = append(row, ms(d))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// saveProfile writes the frame times to ProfileFile.
+func saveProfile(s *frameStats) {
+	if err := saveFile(ProfileFile, profileCSV(s)); err != nil {
+		fmt.Println("Writing profile:", err)
+		return
+	}
+	fmt.Printf("%s (%d frames)\n", savedText(ProfileFile), len(s.history))
+}
@@ -0,0 +1,546 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// QuantizeMethod selects how a palette is built from a true colour image.
+type QuantizeMethod int
+
+const (
+	// QuantizeMedianCut splits the colour space at the median of the most spread channel.
+	QuantizeMedianCut QuantizeMethod = iota
+	// QuantizeOctree builds an octree of colours and merges the least used leaves.
+	QuantizeOctree
+)
+
+// Dither selects how colours are distributed when mapped to a palette.
+type Dither int
+
+const (
+	// DitherNone maps every pixel to the nearest palette colour.
+	DitherNone Dither = iota
+	// DitherBayer uses an 8x8 ordered Bayer matrix.
+	DitherBayer
+	// DitherFloydSteinberg uses Floyd-Steinberg error diffusion.
+	DitherFloydSteinberg
+	// DitherAtkinson uses Atkinson error diffusion,
+	// which only propagates 3/4 of the error.
+	DitherAtkinson
+)
+
+// Quantize describes how a true colour image is reduced to a palette.
+// The zero value quantizes to 256 colours using median cut without dithering.
+type Quantize struct {
+	// Colors is the number of colours to generate.
+	// For grey images it is the number of grey levels.
+	// If 0, 256 is used.
+	Colors int
+
+	// Palette is used as the destination palette, if set.
+	// No palette is generated in this case.
+	// Only the first 256 entries are used.
+	Palette color.Palette
+
+	Method QuantizeMethod
+	Dither Dither
+}
+
+func (q Quantize) colors() int {
+	if q.Colors <= 0 || q.Colors > 256 {
+		return 256
+	}
+	return q.Colors
+}
+
+// palette returns the palette set by the user, limited to 256 entries.
+func (q Quantize) palette() color.Palette {
+	if len(q.Palette) > 256 {
+		return q.Palette[:256]
+	}
+	return q.Palette
+}
+
+// Paletted returns img converted to a paletted image.
+// Pixels with less than 50% alpha are mapped to a transparent palette entry.
+// When a palette is generated, one entry is reserved for this if needed.
+func (q Quantize) Paletted(img image.Image) *image.Paletted {
+	src := toNRGBA(img)
+	pal := q.palette()
+	if len(pal) == 0 {
+		n := q.colors()
+		alpha := hasTransparency(src)
+		if alpha && n > 1 {
+			n--
+		}
+		switch q.Method {
+		case QuantizeOctree:
+			pal = octreePalette(src, n)
+		default:
+			pal = medianCutPalette(src, n)
+		}
+		if alpha {
+			pal = append(pal, color.NRGBA{})
+		}
+	}
+	dst := image.NewPaletted(img.Bounds(), pal)
+	ditherTo(dst, src, q.Dither)
+	return dst
+}
+
+// Gray returns img converted to grey, reduced to the configured number of levels.
+// If a palette is set, the luminance of each palette entry is used as levels.
+func (q Quantize) Gray(img image.Image) *image.Gray {
+	grey := ToGray(img)
+	pal := make(color.Palette, 0, 256)
+	if len(q.Palette) > 0 {
+		for _, c := range q.palette() {
+			pal = append(pal, color.GrayModel.Convert(c))
+		}
+	} else {
+		n := q.colors()
+		for i := 0; i < n; i++ {
+			v := 255
+			if n > 1 {
+				v = (i*255 + (n-1)/2) / (n - 1)
+			}
+			pal = append(pal, color.Gray{Y: uint8(v)})
+		}
+	}
+	idx := image.NewPaletted(grey.Rect, pal)
+	ditherTo(idx, toNRGBA(grey), q.Dither)
+	var levels [256]uint8
+	for i, c := range pal {
+		levels[i] = c.(color.Gray).Y
+	}
+	w := grey.Rect.Dx()
+	for y := 0; y < grey.Rect.Dy(); y++ {
+		line := idx.Pix[y*idx.Stride : y*idx.Stride+w]
+		dLine := grey.Pix[y*grey.Stride : y*grey.Stride+w]
+		for x, v := range line {
+			dLine[x] = levels[v]
+		}
+	}
+	return grey
+}
+
+// toNRGBA returns img as a zero based non-premultiplied image.
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		line := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()*4]
+		for x := 0; x < b.Dx(); x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			line[x*4+0] = c.R
+			line[x*4+1] = c.G
+			line[x*4+2] = c.B
+			line[x*4+3] = c.A
+		}
+	}
+	return dst
+}
+
+// hasTransparency returns whether any pixels will be mapped as transparent.
+func hasTransparency(src *image.NRGBA) bool {
+	w := src.Rect.Dx()
+	for y := 0; y < src.Rect.Dy(); y++ {
+		line := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for x := 0; x < w; x++ {
+			if line[x*4+3] < 128 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type histEntry struct {
+	c [3]uint8
+	n int
+}
+
+func histogram(src *image.NRGBA) []histEntry {
+	counts := make(map[uint32]int)
+	w := src.Rect.Dx()
+	for y := 0; y < src.Rect.Dy(); y++ {
+		line := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for x := 0; x < w; x++ {
+			if line[x*4+3] < 128 {
+				continue
+			}
+			counts[uint32(line[x*4])|uint32(line[x*4+1])<<8|uint32(line[x*4+2])<<16]++
+		}
+	}
+	res := make([]histEntry, 0, len(counts))
+	for k, n := range counts {
+		res = append(res, histEntry{c: [3]uint8{uint8(k), uint8(k >> 8), uint8(k >> 16)}, n: n})
+	}
+	// Map iteration is random, keep the result stable.
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i].c, res[j].c
+		return uint32(a[0])|uint32(a[1])<<8|uint32(a[2])<<16 < uint32(b[0])|uint32(b[1])<<8|uint32(b[2])<<16
+	})
+	return res
+}
+
+func averageColor(h []histEntry) color.Color {
+	var sum [3]int
+	var n int
+	for _, e := range h {
+		for i := range sum {
+			sum[i] += int(e.c[i]) * e.n
+		}
+		n += e.n
+	}
+	if n == 0 {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{
+		R: uint8((sum[0] + n/2) / n),
+		G: uint8((sum[1] + n/2) / n),
+		B: uint8((sum[2] + n/2) / n),
+		A: 255,
+	}
+}
+
+func medianCutPalette(src *image.NRGBA, n int) color.Palette {
+	hist := histogram(src)
+	if len(hist) <= n {
+		pal := make(color.Palette, len(hist))
+		for i, e := range hist {
+			pal[i] = color.RGBA{R: e.c[0], G: e.c[1], B: e.c[2], A: 255}
+		}
+		return pal
+	}
+	type box struct {
+		h      []histEntry
+		ch     int
+		spread int
+	}
+	measure := func(h []histEntry) box {
+		lo, hi := [3]int{255, 255, 255}, [3]int{}
+		for _, e := range h {
+			for i, v := range e.c {
+				if int(v) < lo[i] {
+					lo[i] = int(v)
+				}
+				if int(v) > hi[i] {
+					hi[i] = int(v)
+				}
+			}
+		}
+		b := box{h: h}
+		for i := range lo {
+			if hi[i]-lo[i] > b.spread {
+				b.spread, b.ch = hi[i]-lo[i], i
+			}
+		}
+		return b
+	}
+	boxes := []box{measure(hist)}
+	for len(boxes) < n {
+		// Split the box with the largest spread.
+		best := -1
+		for i, b := range boxes {
+			if len(b.h) > 1 && (best < 0 || b.spread > boxes[best].spread) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		b := boxes[best]
+		ch := b.ch
+		sort.SliceStable(b.h, func(i, j int) bool { return b.h[i].c[ch] < b.h[j].c[ch] })
+		var total int
+		for _, e := range b.h {
+			total += e.n
+		}
+		split, acc := 1, 0
+		for i, e := range b.h[:len(b.h)-1] {
+			acc += e.n
+			split = i + 1
+			if acc*2 >= total {
+				break
+			}
+		}
+		boxes[best] = measure(b.h[:split])
+		boxes = append(boxes, measure(b.h[split:]))
+	}
+	pal := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		pal[i] = averageColor(b.h)
+	}
+	return pal
+}
+
+type octreeNode struct {
+	children [8]*octreeNode
+	sum      [3]int
+	n        int
+	leaf     bool
+}
+
+func octreePalette(src *image.NRGBA, n int) color.Palette {
+	const depth = 8
+	var (
+		root      octreeNode
+		leaves    int
+		reducible [depth][]*octreeNode
+	)
+	for _, e := range histogram(src) {
+		node := &root
+		for level := 0; level < depth; level++ {
+			shift := uint(7 - level)
+			i := (e.c[0]>>shift)&1<<2 | (e.c[1]>>shift)&1<<1 | (e.c[2]>>shift)&1
+			child := node.children[i]
+			if child == nil {
+				child = &octreeNode{leaf: level == depth-1}
+				node.children[i] = child
+				if child.leaf {
+					leaves++
+				} else {
+					reducible[level] = append(reducible[level], child)
+				}
+			}
+			node = child
+		}
+		for i := range node.sum {
+			node.sum[i] += int(e.c[i]) * e.n
+		}
+		node.n += e.n
+	}
+	// Merge the deepest nodes into their parents until we have few enough leaves.
+	for level := depth - 2; level >= 0 && leaves > n; level-- {
+		nodes := reducible[level]
+		// Reduce the least used nodes first.
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count() < nodes[j].count() })
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			for i, child := range node.children {
+				if child == nil {
+					continue
+				}
+				for j := range node.sum {
+					node.sum[j] += child.sum[j]
+				}
+				node.n += child.n
+				node.children[i] = nil
+				leaves--
+			}
+			node.leaf = true
+			leaves++
+		}
+	}
+	pal := make(color.Palette, 0, n)
+	var walk func(node *octreeNode)
+	walk = func(node *octreeNode) {
+		if node.leaf {
+			if node.n > 0 {
+				pal = append(pal, color.RGBA{
+					R: uint8((node.sum[0] + node.n/2) / node.n),
+					G: uint8((node.sum[1] + node.n/2) / node.n),
+					B: uint8((node.sum[2] + node.n/2) / node.n),
+					A: 255,
+				})
+			}
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(&root)
+	if len(pal) == 0 {
+		pal = append(pal, color.RGBA{A: 255})
+	}
+	return pal
+}
+
+// count returns the number of pixels in the node and all children.
+func (o *octreeNode) count() int {
+	n := o.n
+	for _, c := range o.children {
+		if c != nil {
+			n += c.count()
+		}
+	}
+	return n
+}
+
+// palMatcher finds the nearest palette entry.
+// The transparent entry is never returned as nearest.
+type palMatcher struct {
+	pal   [][3]int32
+	key   int
+	cache map[uint32]uint8
+}
+
+func newPalMatcher(p color.Palette) *palMatcher {
+	m := palMatcher{pal: make([][3]int32, len(p)), key: TransparentIndex(p), cache: make(map[uint32]uint8)}
+	for i, c := range p {
+		r, g, b, _ := c.RGBA()
+		m.pal[i] = [3]int32{int32(r >> 8), int32(g >> 8), int32(b >> 8)}
+	}
+	return &m
+}
+
+// transparent returns whether a pixel with alpha a should use the transparent entry.
+func (m *palMatcher) transparent(a uint8) bool {
+	return a < 128 && m.key >= 0
+}
+
+func (m *palMatcher) index(r, g, b int32) uint8 {
+	key := uint32(r) | uint32(g)<<8 | uint32(b)<<16
+	if idx, ok := m.cache[key]; ok {
+		return idx
+	}
+	best, bestD := 0, int32(math.MaxInt32)
+	for i, p := range m.pal {
+		if i == m.key && len(m.pal) > 1 {
+			continue
+		}
+		dr, dg, db := r-p[0], g-p[1], b-p[2]
+		d := dr*dr*2 + dg*dg*4 + db*db*3
+		if d < bestD {
+			best, bestD = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	m.cache[key] = uint8(best)
+	return uint8(best)
+}
+
+var bayer8 = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+type diffusion struct {
+	dx, dy, w int
+}
+
+var (
+	floydSteinberg = struct {
+		div int
+		k   []diffusion
+	}{16, []diffusion{{1, 0, 7}, {-1, 1, 3}, {0, 1, 5}, {1, 1, 1}}}
+	atkinson = struct {
+		div int
+		k   []diffusion
+	}{8, []diffusion{{1, 0, 1}, {2, 0, 1}, {-1, 1, 1}, {0, 1, 1}, {1, 1, 1}, {0, 2, 1}}}
+)
+
+func clamp255(v int32) int32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// ditherTo maps src to the palette of dst using the dither method.
+// dst and src must have the same size.
+func ditherTo(dst *image.Paletted, src *image.NRGBA, d Dither) {
+	m := newPalMatcher(dst.Palette)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	switch d {
+	case DitherBayer:
+		// Spread the threshold by the average distance between colours.
+		spread := 255 / math.Cbrt(float64(len(dst.Palette)))
+		if allGrey(dst.Palette) {
+			spread = 255 / float64(len(dst.Palette))
+		}
+		for y := 0; y < h; y++ {
+			line := src.Pix[y*src.Stride : y*src.Stride+w*4]
+			dLine := dst.Pix[y*dst.Stride : y*dst.Stride+w]
+			for x := range dLine {
+				if m.transparent(line[x*4+3]) {
+					dLine[x] = uint8(m.key)
+					continue
+				}
+				off := int32((float64(bayer8[y&7][x&7])/64 - 0.5) * spread)
+				dLine[x] = m.index(clamp255(int32(line[x*4])+off), clamp255(int32(line[x*4+1])+off), clamp255(int32(line[x*4+2])+off))
+			}
+		}
+	case DitherFloydSteinberg, DitherAtkinson:
+		kernel := floydSteinberg
+		if d == DitherAtkinson {
+			kernel = atkinson
+		}
+		// Error is kept for the current and the two following lines.
+		var errs [3][][3]int32
+		for i := range errs {
+			errs[i] = make([][3]int32, w+4)
+		}
+		for y := 0; y < h; y++ {
+			line := src.Pix[y*src.Stride : y*src.Stride+w*4]
+			dLine := dst.Pix[y*dst.Stride : y*dst.Stride+w]
+			cur := errs[0]
+			for x := range dLine {
+				if m.transparent(line[x*4+3]) {
+					dLine[x] = uint8(m.key)
+					continue
+				}
+				var v [3]int32
+				for c := range v {
+					v[c] = clamp255(int32(line[x*4+c]) + cur[x+2][c]/int32(kernel.div))
+				}
+				idx := m.index(v[0], v[1], v[2])
+				dLine[x] = idx
+				p := m.pal[idx]
+				for _, k := range kernel.k {
+					e := errs[k.dy][x+2+k.dx][:]
+					for c := range v {
+						e[c] += (v[c] - p[c]) * int32(k.w)
+					}
+				}
+			}
+			// Rotate error lines.
+			errs[0], errs[1], errs[2] = errs[1], errs[2], errs[0]
+			for i := range errs[2] {
+				errs[2][i] = [3]int32{}
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			line := src.Pix[y*src.Stride : y*src.Stride+w*4]
+			dLine := dst.Pix[y*dst.Stride : y*dst.Stride+w]
+			for x := range dLine {
+				if m.transparent(line[x*4+3]) {
+					dLine[x] = uint8(m.key)
+					continue
+				}
+				dLine[x] = m.index(int32(line[x*4]), int32(line[x*4+1]), int32(line[x*4+2]))
+			}
+		}
+	}
+}
+
+func allGrey(p color.Palette) bool {
+	for _, c := range p {
+		r, g, b, a := c.RGBA()
+		if a != 0 && (r != g || g != b) {
+			return false
+		}
+	}
+	return true
+}
@@ -10,6 +10,13 @@ type TimedEffect interface {
 	Render(t float64) image.Image
 }
 
+// InteractiveEffect is an effect that receives input.
+// HandleInput is called before every Render with the input of the frame.
+type InteractiveEffect interface {
+	TimedEffect
+	HandleInput(in Input)
+}
+
 type ProgressiveEffect interface {
 	Reset(o Options)
 	Render() image.Image
@@ -0,0 +1,17 @@
+// +build wasm
+
+package gfx
+
+import "fmt"
+
+// saveFile prints output of the runner, like presets, to the console,
+// since files cannot be written from the browser.
+func saveFile(name string, b []byte) error {
+	fmt.Printf("%s:\n%s\n", name, b)
+	return nil
+}
+
+// savedText describes where saveFile put name.
+func savedText(name string) string {
+	return "Printed " + name + " to console"
+}
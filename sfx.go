@@ -0,0 +1,397 @@
+// +build !wasm
+
+package gfx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+)
+
+// sfxMixer is played on the speaker and mixes the music and sound effects.
+// Since music and sounds are mixed here, sounds can be scheduled
+// at exact music positions.
+type sfxMixer struct {
+	mu         sync.Mutex
+	rate       beep.SampleRate
+	pos        int64
+	music      beep.Streamer
+	musicStart int64
+	musicPos   int64
+	seek       func(pos time.Duration) (time.Duration, error)
+	clock      *musicClock
+	voices     []*Voice
+	buf        [][2]float64
+
+	// follow is the position of music not streamed by the mixer, like a SilentPlayer.
+	follow func() time.Duration
+
+	// ended is set when the music has ended.
+	ended bool
+
+	// ctl is a copy of the music settings taken for each Stream call.
+	ctl musicState
+
+	// segments are the music positions of the samples streamed now.
+	segments []musicSegment
+}
+
+// musicSegment is music from pos streamed to the mixer samples from off.
+type musicSegment struct {
+	off int
+	pos int64
+	n   int
+}
+
+// mixer is created when the speaker is initialized.
+var mixer *sfxMixer
+
+// playMusic starts playing the music with the next samples.
+// If seek isn't nil the music can loop, and loops are applied to clock.
+func playMusic(s beep.Streamer, seek func(pos time.Duration) (time.Duration, error), clock *musicClock) {
+	mixer.mu.Lock()
+	mixer.music = s
+	mixer.musicStart = mixer.pos
+	mixer.musicPos = 0
+	mixer.seek = seek
+	mixer.clock = clock
+	mixer.follow = nil
+	mixer.ended = false
+	mixer.mu.Unlock()
+}
+
+// followMusic schedules sounds against the position of music
+// that isn't played by the mixer.
+func followMusic(pos func() time.Duration) {
+	if mixer == nil {
+		return
+	}
+	mixer.mu.Lock()
+	mixer.music = nil
+	mixer.follow = pos
+	mixer.ended = false
+	mixer.mu.Unlock()
+}
+
+func (m *sfxMixer) Stream(samples [][2]float64) (n int, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range samples {
+		samples[i] = [2]float64{}
+	}
+	if len(m.buf) < len(samples) {
+		m.buf = make([][2]float64, len(samples))
+	}
+	m.segments = m.segments[:0]
+	musicCtl.snapshot(&m.ctl)
+	switch {
+	case m.music != nil:
+		m.streamMusic(samples)
+	case m.follow != nil:
+		m.musicPos = m.musicSample(m.follow())
+		m.segments = append(m.segments, musicSegment{pos: m.musicPos, n: len(samples)})
+		m.musicPos += int64(len(samples))
+	}
+	end := m.pos + int64(len(samples))
+	loopStart, loopEnd, loop := m.ctl.loop()
+	live := m.voices[:0]
+	for _, v := range m.voices {
+		if v.stopped {
+			continue
+		}
+		from := 0
+		if v.start > m.pos {
+			from = int(v.start - m.pos)
+		}
+		if v.scheduled {
+			// Start the voice every time the music passes it.
+			at := m.musicSample(v.at)
+			for _, s := range m.segments {
+				if at < s.pos || at >= s.pos+int64(s.n) {
+					continue
+				}
+				off := s.off + int(at-s.pos)
+				if v.playing && from < off {
+					v.mix(samples[from:off])
+				}
+				v.playing, v.pos, v.start = true, 0, m.pos+int64(off)
+				from = off
+			}
+			switch {
+			case m.ended:
+				// The music never reaches the voice.
+				v.waiting = false
+			case m.music != nil || m.follow != nil:
+				v.waiting = at >= m.musicPos
+			}
+		}
+		if v.playing && v.start < end {
+			v.mix(samples[from:])
+		}
+		// Scheduled voices in the loop are kept, so they play again.
+		inLoop := v.scheduled && !m.ended && loop && v.at >= loopStart && v.at < loopEnd
+		if v.playing || v.waiting || inLoop {
+			live = append(live, v)
+		}
+	}
+	for i := len(live); i < len(m.voices); i++ {
+		m.voices[i] = nil
+	}
+	m.voices = live
+	m.pos = end
+	return len(samples), true
+}
+
+// streamMusic adds the music to samples with the loop and volume applied.
+func (m *sfxMixer) streamMusic(samples [][2]float64) {
+	buf := m.buf[:len(samples)]
+	for done := 0; done < len(samples); {
+		todo := len(samples) - done
+		if _, end, ok := m.ctl.loop(); ok && m.seek != nil {
+			// Stop exactly at the end of the loop.
+			if left := int64(m.rate.N(end)) - m.musicPos; left > 0 && left < int64(todo) {
+				todo = int(left)
+			}
+		}
+		n, ok := m.music.Stream(buf[done : done+todo])
+		m.segments = append(m.segments, musicSegment{off: done, pos: m.musicPos, n: n})
+		m.mixMusic(samples[done:done+n], buf[done:done+n])
+		done += n
+		m.musicPos += int64(n)
+		if !ok {
+			m.music, m.ended = nil, true
+			return
+		}
+		if n == 0 {
+			return
+		}
+		if m.seek == nil {
+			continue
+		}
+		if p, loop := m.ctl.looped(m.rate.D(int(m.musicPos))); loop {
+			p, err := m.seek(p)
+			if err == errLoopPending {
+				continue
+			}
+			if err != nil {
+				fmt.Println("Cannot loop music:", err)
+				m.seek = nil
+				continue
+			}
+			m.musicPos = int64(m.rate.N(p))
+			m.clock.jump(m.rate.D(int(m.pos-m.musicStart)+done), p)
+		}
+	}
+}
+
+// gainStep is the number of samples the music gain is interpolated over.
+const gainStep = 64
+
+// mixMusic adds music starting at musicPos to out with the gain applied.
+func (m *sfxMixer) mixMusic(out, music [][2]float64) {
+	g1 := m.ctl.gain(m.rate.D(int(m.musicPos)))
+	for i := 0; i < len(music); i += gainStep {
+		g0 := g1
+		g1 = m.ctl.gain(m.rate.D(int(m.musicPos) + i + gainStep))
+		block := music[i:]
+		if len(block) > gainStep {
+			block = block[:gainStep]
+		}
+		for j, s := range block {
+			g := g0 + (g1-g0)*float64(j)/gainStep
+			out[i+j][0] += s[0] * g
+			out[i+j][1] += s[1] * g
+		}
+	}
+}
+
+// musicSample returns the music sample at t.
+func (m *sfxMixer) musicSample(t time.Duration) int64 {
+	return int64(math.Round(t.Seconds() * float64(m.rate)))
+}
+
+func (m *sfxMixer) Err() error {
+	return nil
+}
+
+// Sound is a sound effect decoded into memory.
+type Sound struct {
+	samples [][2]float64
+	rate    beep.SampleRate
+}
+
+// LoadSound loads and decodes a sound effect.
+// Sounds are read using Load, falling back to disk if no source has the file.
+// If the speaker hasn't been initialized by music yet, it is initialized.
+// With SilentMusic or if no audio device is available,
+// the sound is decoded but playing it does nothing.
+func LoadSound(path string) (*Sound, error) {
+	s, format, err := openMusic(path)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	snd := Sound{rate: format.SampleRate}
+	var playing beep.Streamer = s
+	if !silentMusic {
+		var noAudio *audioInitError
+		p, err := soundSpeaker(s, format)
+		switch {
+		case errors.As(err, &noAudio):
+			fmt.Println(err, "- sounds are not played")
+		case err != nil:
+			return nil, err
+		default:
+			playing, snd.rate = p, speakerFormat.SampleRate
+		}
+	}
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := playing.Stream(buf)
+		snd.samples = append(snd.samples, buf[:n]...)
+		if !ok {
+			break
+		}
+	}
+	return &snd, s.Err()
+}
+
+// soundSpeaker initializes the speaker if needed and returns s resampled to the speaker.
+func soundSpeaker(s beep.Streamer, format beep.Format) (beep.Streamer, error) {
+	if speakerFormat == nil {
+		// Use the format of rendered music, since music is likely to follow.
+		_, err := initSpeaker(nil, beep.Format{SampleRate: renderSampleRate, NumChannels: 2, Precision: 2})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return initSpeaker(s, format)
+}
+
+// Duration returns the duration of the sound.
+func (s *Sound) Duration() time.Duration {
+	return s.rate.D(len(s.samples))
+}
+
+// Play the sound now.
+func (s *Sound) Play(o PlayOptions) *Voice {
+	return s.play(&Voice{}, o)
+}
+
+// PlayAt plays the sound when the music reaches position t.
+// If t has passed, the sound is started now.
+// If no music is playing, the sound waits for music to start.
+// If the music ends before t, the sound is not played.
+// If t is inside the music loop, the sound is played every time the music loops.
+func (s *Sound) PlayAt(t time.Duration, o PlayOptions) *Voice {
+	return s.play(&Voice{at: t, scheduled: true}, o)
+}
+
+func (s *Sound) play(v *Voice, o PlayOptions) *Voice {
+	v.sound = s
+	v.volume, v.pan, v.loop = o.Volume, o.Pan, o.Loop
+	if mixer == nil {
+		// No audio output.
+		return v
+	}
+	mixer.mu.Lock()
+	v.start = mixer.pos
+	v.playing = !v.scheduled
+	if v.scheduled {
+		timed := mixer.music != nil || mixer.follow != nil || mixer.ended
+		passed := timed && mixer.musicSample(v.at) < mixer.musicPos
+		v.playing, v.waiting = passed, !passed && !mixer.ended
+	}
+	mixer.voices = append(mixer.voices, v)
+	mixer.mu.Unlock()
+	return v
+}
+
+// Voice is a sound that is playing or waiting to be played.
+type Voice struct {
+	sound     *Sound
+	at        time.Duration
+	scheduled bool
+	start     int64
+	pos       int
+
+	volume, pan float64
+	loop        bool
+
+	// playing is set while the sound is heard and waiting while
+	// a scheduled voice waits for the music to reach at.
+	// A voice can do both when the music loops.
+	playing, waiting bool
+	stopped          bool
+}
+
+// mix adds the voice to out. Must be called with the mixer locked.
+func (v *Voice) mix(out [][2]float64) {
+	l, r := voiceGains(v.volume, v.pan)
+	data := v.sound.samples
+	for i := range out {
+		if v.pos >= len(data) {
+			if !v.loop || len(data) == 0 {
+				v.playing = false
+				return
+			}
+			v.pos = 0
+		}
+		s := data[v.pos]
+		out[i][0] += s[0] * l
+		out[i][1] += s[1] * r
+		v.pos++
+	}
+}
+
+// SetVolume changes the volume of the voice, 0 -> 1.
+func (v *Voice) SetVolume(vol float64) {
+	if mixer == nil {
+		return
+	}
+	mixer.mu.Lock()
+	v.volume = vol
+	mixer.mu.Unlock()
+}
+
+// SetPan changes the panning of the voice, -1 (left) -> 1 (right).
+func (v *Voice) SetPan(pan float64) {
+	if mixer == nil {
+		return
+	}
+	mixer.mu.Lock()
+	v.pan = pan
+	mixer.mu.Unlock()
+}
+
+// Stop the voice.
+func (v *Voice) Stop() {
+	if mixer == nil {
+		return
+	}
+	mixer.mu.Lock()
+	v.stopped = true
+	mixer.mu.Unlock()
+}
+
+// Playing returns true until the voice has been stopped or has finished.
+// Voices played at a time in the music loop play again when the music loops.
+func (v *Voice) Playing() bool {
+	if mixer == nil {
+		return false
+	}
+	mixer.mu.Lock()
+	defer mixer.mu.Unlock()
+	return !v.stopped && (v.playing || v.waiting)
+}
+
+// initMixer starts the mixer on the speaker.
+func initMixer(rate beep.SampleRate) {
+	mixer = &sfxMixer{rate: rate, musicStart: -1}
+	speaker.Play(mixer)
+}
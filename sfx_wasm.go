@@ -0,0 +1,97 @@
+// +build wasm
+
+package gfx
+
+import (
+	"sync"
+	"time"
+)
+
+// Sound is a sound effect played by audio elements.
+type Sound struct {
+	url jsObject
+}
+
+// LoadSound loads a sound effect using Load.
+func LoadSound(path string) (*Sound, error) {
+	b, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sound{}
+	el := Global.Get("Audio").New()
+	setBlobSource(el, b)
+	s.url = el.Get("src")
+	return s, nil
+}
+
+// Play the sound now.
+// Panning is not supported with wasm.
+func (s *Sound) Play(o PlayOptions) *Voice {
+	v := s.newVoice(o)
+	v.el.Call("play")
+	return v
+}
+
+// PlayAt plays the sound when the music reaches position t.
+// If t has passed, the sound is started now.
+// If no music is playing, the sound waits for music to start.
+func (s *Sound) PlayAt(t time.Duration, o PlayOptions) *Voice {
+	v := s.newVoice(o)
+	go func() {
+		for {
+			v.mu.Lock()
+			stopped := v.stopped
+			v.mu.Unlock()
+			if stopped {
+				return
+			}
+			if music != nil && music.Pos() >= t {
+				v.el.Call("play")
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	return v
+}
+
+// followMusic does nothing with wasm, since PlayAt polls the music position.
+func followMusic(pos func() time.Duration) {}
+
+func (s *Sound) newVoice(o PlayOptions) *Voice {
+	v := &Voice{el: Global.Get("Audio").New(s.url)}
+	v.el.Set("volume", clampF(o.Volume, 0, 1))
+	v.el.Set("loop", o.Loop)
+	return v
+}
+
+// Voice is a sound that is playing or waiting to be played.
+type Voice struct {
+	el      jsObject
+	mu      sync.Mutex
+	stopped bool
+}
+
+// SetVolume changes the volume of the voice, 0 -> 1.
+func (v *Voice) SetVolume(vol float64) {
+	v.el.Set("volume", clampF(vol, 0, 1))
+}
+
+// SetPan is not supported with wasm.
+func (v *Voice) SetPan(pan float64) {}
+
+// Stop the voice.
+func (v *Voice) Stop() {
+	v.mu.Lock()
+	v.stopped = true
+	v.mu.Unlock()
+	v.el.Call("pause")
+}
+
+// Playing returns true until the voice has been stopped or has finished.
+func (v *Voice) Playing() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return !v.stopped && !v.el.Get("ended").Bool()
+}
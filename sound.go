@@ -3,38 +3,79 @@
 package gfx
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/faiface/beep"
-	"github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/speaker"
 )
 
-type mp3Player struct {
-	streamer  beep.StreamSeekCloser
-	format    beep.Format
-	file      *os.File
-	startedAt time.Time
+type musicPlayer struct {
+	streamer beep.StreamSeekCloser
+	format   beep.Format
+	playing  beep.Streamer
+	clock    musicClock
+	*audioAnalyzer
 }
 
+// tapStreamer sends the audio passing through to an analyzer.
+type tapStreamer struct {
+	s beep.Streamer
+	a *audioAnalyzer
+}
+
+func (t tapStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = t.s.Stream(samples)
+	t.a.write(samples[:n])
+	return n, ok
+}
+
+func (t tapStreamer) Err() error {
+	return t.s.Err()
+}
+
+// speakerFormat is the format the speaker was initialized with.
+var speakerFormat *beep.Format
+
+// initSpeaker initializes the speaker and the mixer with the format if not done already.
+// The stream is resampled if the speaker uses a different sample rate.
+func initSpeaker(s beep.Streamer, f beep.Format) (beep.Streamer, error) {
+	if speakerFormat == nil {
+		err := speaker.Init(f.SampleRate, f.SampleRate.N(time.Second/10))
+		if err != nil {
+			return nil, &audioInitError{err: err}
+		}
+		speakerFormat = &f
+		initMixer(f.SampleRate)
+		applyConfig()
+	}
+	if speakerFormat.SampleRate != f.SampleRate {
+		return beep.Resample(4, f.SampleRate, speakerFormat.SampleRate, s), nil
+	}
+	return s, nil
+}
+
+// loadMusic loads mp3, ogg vorbis, wav, flac, module or synth music.
 func loadMusic(path string) (MusicPlayer, error) {
-	fp, err := filepath.Abs(path)
+	b, err := readMusic(path)
 	if err != nil {
 		return nil, err
 	}
-	m := mp3Player{}
-	m.file, err = os.Open(fp)
-	if err != nil {
-		return nil, err
+	switch musicFormat(b, path) {
+	case "mod", "xm":
+		return openModule(b)
+	case "synth":
+		return openSynth(b)
 	}
-	m.streamer, m.format, err = mp3.Decode(m.file)
+	m := musicPlayer{}
+	m.streamer, m.format, err = decodeMusic(b, path)
 	if err != nil {
 		return nil, err
 	}
-	err = speaker.Init(m.format.SampleRate, m.format.SampleRate.N(time.Second/10))
+	m.audioAnalyzer = newAudioAnalyzer(int(m.format.SampleRate), m.format.SampleRate.N(analysisBuffer))
+	m.playing, err = initSpeaker(tapStreamer{s: m.streamer, a: m.audioAnalyzer}, m.format)
 	if err != nil {
 		return nil, err
 	}
@@ -42,14 +83,14 @@ func loadMusic(path string) (MusicPlayer, error) {
 	return &m, nil
 }
 
-func (m *mp3Player) Start(cb func(duration time.Duration)) {
-	speaker.Play(beep.Seq(m.streamer, beep.Callback(func() {
+func (m *musicPlayer) Start(cb func(duration time.Duration)) {
+	playMusic(beep.Seq(m.playing, beep.Callback(func() {
 		// Callback after the stream Ends
 		fmt.Println("done")
-	})))
+	})), m.seek, &m.clock)
 	// We have no reasonable way to get info on exactly when playback started.
 	// We can only see side effects on the stream, so we assume it started *now*
-	m.startedAt = time.Now()
+	m.clock.start()
 	if false {
 		go func() {
 			t := time.NewTicker(time.Second)
@@ -64,11 +105,188 @@ func (m *mp3Player) Start(cb func(duration time.Duration)) {
 	cb(0)
 }
 
-func (m *mp3Player) Pos() time.Duration {
+func (m *musicPlayer) Pos() time.Duration {
 	if false {
 		p := m.streamer.Position()
 		d := time.Second * time.Duration(p) / time.Duration(m.format.SampleRate)
-		fmt.Println("pos:", p, "dur:", d, "since start:", time.Since(m.startedAt))
+		fmt.Println("pos:", p, "dur:", d, "clock:", m.clock.pos())
+	}
+	return m.clock.pos()
+}
+
+// seek the music and the analysis to pos.
+func (m *musicPlayer) seek(pos time.Duration) (time.Duration, error) {
+	p := m.format.SampleRate.N(pos)
+	if err := m.streamer.Seek(p); err != nil {
+		return 0, err
+	}
+	m.audioAnalyzer.seek(int64(p))
+	return pos, nil
+}
+
+// maxLoopCache is the longest loop kept in memory by rendered music.
+const maxLoopCache = time.Minute
+
+// renderBackend plays rendered music on the speaker.
+type renderBackend struct {
+	playing beep.Streamer
+
+	// pos is the position of the next sample streamed and rendered the position of the renderer.
+	pos, rendered int64
+
+	// cache contains the samples rendered since the last seek, ending at rendered.
+	// It is used when looping, so the music isn't rendered again.
+	cache      [][2]float32
+	cacheStart int64
+	caching    bool
+
+	// ahead is a renderer moved to the start of the loop in the background,
+	// so looping never renders from the beginning on the audio thread.
+	aheadMu sync.Mutex
+	ahead   *renderAhead
+}
+
+// renderAhead is a renderer that has rendered up to pos when ready is set.
+type renderAhead struct {
+	pos    int64
+	render func(buf [][2]float64) int
+	ready  bool
+}
+
+// errLoopPending is returned by seek when the renderer for the loop isn't ready.
+// The loop is tried again with the next samples.
+var errLoopPending = errors.New("loop not rendered yet")
+
+// open initializes the speaker, unless the music is open already.
+func (r *renderedMusic) open() error {
+	if r.audioAnalyzer != nil {
+		return nil
 	}
-	return time.Since(m.startedAt)
+	a := newAudioAnalyzer(renderSampleRate, beep.SampleRate(renderSampleRate).N(analysisBuffer))
+	playing, err := initSpeaker(r, beep.Format{SampleRate: renderSampleRate, NumChannels: 2, Precision: 2})
+	if err != nil {
+		return err
+	}
+	r.audioAnalyzer, r.playing = a, playing
+	return nil
+}
+
+// Stream renders the music. It implements beep.Streamer.
+func (r *renderedMusic) Stream(samples [][2]float64) (n int, ok bool) {
+	if start, _, loop := musicLoop(); loop {
+		r.prepare(durToSamples(start))
+	}
+	for n < len(samples) {
+		if r.pos < r.rendered {
+			// Play from the cache.
+			c := r.cache[r.pos-r.cacheStart:]
+			k := len(samples) - n
+			if k > len(c) {
+				k = len(c)
+			}
+			for i, s := range c[:k] {
+				samples[n+i] = [2]float64{float64(s[0]), float64(s[1])}
+			}
+			n += k
+			r.pos += int64(k)
+			continue
+		}
+		k := r.render(samples[n:])
+		if r.caching && len(r.cache)+k > int(durToSamples(maxLoopCache)) {
+			r.caching, r.cache = false, nil
+		}
+		if r.caching {
+			for _, s := range samples[n : n+k] {
+				r.cache = append(r.cache, [2]float32{float32(s[0]), float32(s[1])})
+			}
+		}
+		n += k
+		r.pos += int64(k)
+		r.rendered += int64(k)
+		if k == 0 {
+			break
+		}
+	}
+	r.audioAnalyzer.write(samples[:n])
+	return n, n > 0
+}
+
+// prepare starts moving a new renderer to pos in the background,
+// unless pos is cached or a renderer is already moved there.
+func (r *renderedMusic) prepare(pos int64) {
+	if r.caching && pos >= r.cacheStart && pos <= r.rendered {
+		return
+	}
+	r.aheadMu.Lock()
+	defer r.aheadMu.Unlock()
+	if r.ahead != nil && r.ahead.pos == pos {
+		return
+	}
+	a := &renderAhead{pos: pos}
+	r.ahead = a
+	go func() {
+		render := r.restart()
+		buf := make([][2]float64, 4096)
+		for done := int64(0); done < pos; {
+			todo := pos - done
+			if todo > int64(len(buf)) {
+				todo = int64(len(buf))
+			}
+			k := render(buf[:todo])
+			if k == 0 {
+				break
+			}
+			done += int64(k)
+		}
+		r.aheadMu.Lock()
+		a.render, a.ready = render, true
+		r.aheadMu.Unlock()
+	}()
+}
+
+// seek to pos. Positions in the cache are played from memory,
+// otherwise the renderer prepared for the loop is used.
+// The position seeked to is returned.
+func (r *renderedMusic) seek(pos time.Duration) (time.Duration, error) {
+	p := durToSamples(pos)
+	if r.caching && p >= r.cacheStart && p <= r.rendered {
+		r.audioAnalyzer.seek(p)
+		r.pos = p
+		return pos, nil
+	}
+	r.aheadMu.Lock()
+	a := r.ahead
+	if a == nil || !a.ready || a.pos > p {
+		// Stream prepares the renderer.
+		r.aheadMu.Unlock()
+		return 0, errLoopPending
+	}
+	r.ahead = nil
+	r.aheadMu.Unlock()
+
+	// If the loop was late, play from the start of the loop.
+	r.render = a.render
+	r.pos, r.rendered = a.pos, a.pos
+	r.caching, r.cache, r.cacheStart = true, r.cache[:0], a.pos
+	r.audioAnalyzer.seek(a.pos)
+	return time.Duration(a.pos * int64(time.Second) / renderSampleRate), nil
+}
+
+// Err implements beep.Streamer.
+func (r *renderedMusic) Err() error {
+	return nil
+}
+
+// Start opens the speaker if RunTimedMusicPlayer hasn't, and starts the music.
+func (r *renderedMusic) Start(cb func(duration time.Duration)) {
+	if err := r.open(); err != nil {
+		panic(err)
+	}
+	playMusic(r.playing, r.seek, &r.clock)
+	r.clock.start()
+	cb(0)
+}
+
+func (r *renderedMusic) Pos() time.Duration {
+	return r.clock.pos()
 }
@@ -0,0 +1,236 @@
+package gfx
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// musicSettings controls how the music is played.
+type musicSettings struct {
+	mu sync.Mutex
+	musicState
+
+	// latency is subtracted from the music clock.
+	latency    time.Duration
+	latencySet bool
+}
+
+// musicState is the loop, volume and fades applied to the music.
+// The mixer copies it, so the settings aren't locked for every sample.
+type musicState struct {
+	loopStart, loopEnd time.Duration
+	volume             float64
+	muted              bool
+	fades              []musicFade
+}
+
+// snapshot copies the state to dst, reusing the fades of dst.
+func (m *musicSettings) snapshot(dst *musicState) {
+	m.mu.Lock()
+	fades := dst.fades[:0]
+	*dst = m.musicState
+	dst.fades = append(fades, m.fades...)
+	m.mu.Unlock()
+}
+
+// musicFade is a fade in or out.
+type musicFade struct {
+	at, dur time.Duration
+	in      bool
+}
+
+var musicCtl = musicSettings{musicState: musicState{volume: 1}}
+
+// SetMusicLoop repeats the music between start and end.
+// When the music reaches end, both the music and the effect time continue from start.
+// If the music is past end already, it jumps to start right away.
+// Use an end before or at start to disable the loop.
+func SetMusicLoop(start, end time.Duration) {
+	musicCtl.mu.Lock()
+	musicCtl.loopStart, musicCtl.loopEnd = start, end
+	musicCtl.mu.Unlock()
+}
+
+// musicLoop returns the loop region set by SetMusicLoop.
+func musicLoop() (start, end time.Duration, ok bool) {
+	musicCtl.mu.Lock()
+	defer musicCtl.mu.Unlock()
+	return musicCtl.loop()
+}
+
+func (s *musicState) loop() (start, end time.Duration, ok bool) {
+	return s.loopStart, s.loopEnd, s.loopEnd > s.loopStart
+}
+
+// loopedPos returns the position after looping if pos has passed the end of the loop.
+func loopedPos(pos time.Duration) (time.Duration, bool) {
+	musicCtl.mu.Lock()
+	defer musicCtl.mu.Unlock()
+	return musicCtl.looped(pos)
+}
+
+func (s *musicState) looped(pos time.Duration) (time.Duration, bool) {
+	start, end, ok := s.loop()
+	if !ok || pos < end {
+		return pos, false
+	}
+	over := pos - end
+	if over >= end-start {
+		over = 0
+	}
+	return start + over, true
+}
+
+// SetMusicVolume sets the master volume of the music, 0 -> 1.
+func SetMusicVolume(v float64) {
+	musicCtl.mu.Lock()
+	musicCtl.volume = clampF(v, 0, 1)
+	musicCtl.mu.Unlock()
+}
+
+// SetMusicMuted mutes or unmutes the music.
+// The music keeps playing while muted.
+func SetMusicMuted(b bool) {
+	musicCtl.mu.Lock()
+	musicCtl.muted = b
+	musicCtl.mu.Unlock()
+}
+
+// MusicMuted returns whether the music is muted.
+func MusicMuted() bool {
+	musicCtl.mu.Lock()
+	defer musicCtl.mu.Unlock()
+	return musicCtl.muted
+}
+
+// MusicFadeIn fades the music in over dur, starting at music position at.
+// If the first fade is a fade in, the music is silent until it starts.
+func MusicFadeIn(at, dur time.Duration) {
+	addFade(musicFade{at: at, dur: dur, in: true})
+}
+
+// MusicFadeOut fades the music out over dur, starting at music position at.
+func MusicFadeOut(at, dur time.Duration) {
+	addFade(musicFade{at: at, dur: dur})
+}
+
+// ClearMusicFades removes all fades.
+func ClearMusicFades() {
+	musicCtl.mu.Lock()
+	musicCtl.fades = nil
+	musicCtl.mu.Unlock()
+}
+
+func addFade(f musicFade) {
+	musicCtl.mu.Lock()
+	defer musicCtl.mu.Unlock()
+	musicCtl.fades = append(musicCtl.fades, f)
+	sort.SliceStable(musicCtl.fades, func(i, j int) bool {
+		return musicCtl.fades[i].at < musicCtl.fades[j].at
+	})
+}
+
+// musicGain returns the volume of the music at pos,
+// with master volume, fades and mute applied.
+func musicGain(pos time.Duration) float64 {
+	musicCtl.mu.Lock()
+	defer musicCtl.mu.Unlock()
+	return musicCtl.gain(pos)
+}
+
+func (s *musicState) gain(pos time.Duration) float64 {
+	if s.muted {
+		return 0
+	}
+	g := 1.0
+	if len(s.fades) > 0 && s.fades[0].in {
+		g = 0
+	}
+	for _, f := range s.fades {
+		if pos < f.at {
+			break
+		}
+		to := 0.0
+		if f.in {
+			to = 1
+		}
+		if pos < f.at+f.dur {
+			return s.volume * (g + (to-g)*float64(pos-f.at)/float64(f.dur))
+		}
+		g = to
+	}
+	return s.volume * g
+}
+
+// SetAudioLatency sets the time from samples being played until they are heard.
+// The latency is subtracted from the position of the music,
+// so effects match what is heard.
+// This overrides the latency stored by RunCalibration.
+func SetAudioLatency(d time.Duration) {
+	musicCtl.mu.Lock()
+	musicCtl.latency, musicCtl.latencySet = d, true
+	musicCtl.mu.Unlock()
+}
+
+// AudioLatency returns the latency subtracted from the position of the music.
+func AudioLatency() time.Duration {
+	musicCtl.mu.Lock()
+	defer musicCtl.mu.Unlock()
+	return musicCtl.latency
+}
+
+// musicClock is the position of music playing in real time.
+// Jumps made by loops are applied when playback reaches them.
+// The audio latency is subtracted from the position,
+// which stays at 0 until the latency has passed.
+type musicClock struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	offset    time.Duration
+	jumps     []clockJump
+}
+
+// clockJump sets the position to pos when the music has played for at.
+type clockJump struct {
+	at, pos time.Duration
+}
+
+// start the clock at 0.
+func (c *musicClock) start() {
+	c.mu.Lock()
+	c.startedAt = time.Now()
+	c.offset = 0
+	c.jumps = nil
+	c.mu.Unlock()
+}
+
+func (c *musicClock) pos() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := time.Since(c.startedAt) - AudioLatency()
+	for len(c.jumps) > 0 && e >= c.jumps[0].at {
+		c.offset = c.jumps[0].pos - c.jumps[0].at
+		c.jumps = c.jumps[1:]
+	}
+	if e+c.offset < 0 {
+		return 0
+	}
+	return e + c.offset
+}
+
+// jump sets the position to pos when the music has played for at.
+// Jumps must be added in order.
+func (c *musicClock) jump(at, pos time.Duration) {
+	c.mu.Lock()
+	c.jumps = append(c.jumps, clockJump{at: at, pos: pos})
+	c.mu.Unlock()
+}
+
+// set the position now.
+func (c *musicClock) set(pos time.Duration) {
+	c.mu.Lock()
+	c.offset = pos - (time.Since(c.startedAt) - AudioLatency())
+	c.jumps = nil
+	c.mu.Unlock()
+}
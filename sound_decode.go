@@ -0,0 +1,205 @@
+// +build !wasm
+
+package gfx
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+	"github.com/klauspost/gfx/internal/pcm"
+	"github.com/klauspost/gfx/synth"
+	"github.com/klauspost/gfx/tracker"
+)
+
+// readMusic reads the music using Load.
+// If no loader has the file, it is read from disk.
+// Other errors from the loader are returned.
+func readMusic(path string) ([]byte, error) {
+	b, err := Load(path)
+	if err == nil {
+		return b, nil
+	}
+	if !isNotExist(err) {
+		return nil, err
+	}
+	fp, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(fp)
+}
+
+// musicFormat returns the format of the music in b.
+// The content is checked first, then the extension of the path.
+func musicFormat(b []byte, path string) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("OggS")):
+		return "vorbis"
+	case bytes.HasPrefix(b, []byte("fLaC")):
+		return "flac"
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WAVE":
+		return "wav"
+	case bytes.HasPrefix(b, []byte("ID3")), len(b) >= 2 && b[0] == 0xff && b[1]&0xe0 == 0xe0:
+		return "mp3"
+	case tracker.Detect(b) != "":
+		return tracker.Detect(b)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg", ".oga":
+		return "vorbis"
+	case ".flac":
+		return "flac"
+	case ".wav":
+		return "wav"
+	case ".mod":
+		return "mod"
+	case ".xm":
+		return "xm"
+	case ".synth":
+		return "synth"
+	}
+	return "mp3"
+}
+
+// readSeekNopCloser adds a Close method to a bytes.Reader.
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error { return nil }
+
+// decodeMusic returns a decoder for the music in b.
+func decodeMusic(b []byte, path string) (beep.StreamSeekCloser, beep.Format, error) {
+	r := readSeekNopCloser{bytes.NewReader(b)}
+	switch f := musicFormat(b, path); f {
+	case "vorbis":
+		return vorbis.Decode(r)
+	case "flac":
+		return flac.Decode(r)
+	case "wav":
+		return wav.Decode(r)
+	case "mp3":
+		return mp3.Decode(r)
+	default:
+		return nil, beep.Format{}, fmt.Errorf("unknown music format %q", f)
+	}
+}
+
+// openMusic reads and decodes music.
+func openMusic(path string) (beep.StreamSeekCloser, beep.Format, error) {
+	b, err := readMusic(path)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	return decodeMusic(b, path)
+}
+
+// decodeAllMusic decodes the complete music, including modules.
+// The samples and the sample rate are returned.
+func decodeAllMusic(path string) ([][2]float64, int, error) {
+	return decodeMusicSamples(path, 0)
+}
+
+// decodeMusicSamples decodes the music, including modules.
+// If max is not 0, decoding stops when max of the music has been decoded.
+// Modules and synth songs are limited to pcm.MaxSeconds,
+// since they may never end.
+// The samples and the sample rate are returned.
+func decodeMusicSamples(path string, max time.Duration) ([][2]float64, int, error) {
+	b, err := readMusic(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var (
+		render pcm.RenderFunc
+		stream beep.StreamSeekCloser
+	)
+	rate, limit := renderSampleRate, renderSampleRate*pcm.MaxSeconds
+	switch musicFormat(b, path) {
+	case "mod", "xm":
+		mod, err := tracker.Decode(b)
+		if err != nil {
+			return nil, 0, err
+		}
+		render = tracker.NewPlayer(mod, rate).Render
+	case "synth":
+		song, err := synth.Parse(b)
+		if err != nil {
+			return nil, 0, err
+		}
+		render = synth.NewPlayer(song, rate).Render
+	default:
+		var format beep.Format
+		stream, format, err = decodeMusic(b, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer stream.Close()
+		rate, limit = int(format.SampleRate), math.MaxInt32
+		render = func(buf [][2]float64) int {
+			n := 0
+			for n < len(buf) {
+				k, ok := stream.Stream(buf[n:])
+				n += k
+				if !ok || k == 0 {
+					break
+				}
+			}
+			return n
+		}
+	}
+	if max > 0 {
+		if n := int(int64(max) * int64(rate) / int64(time.Second)); n < limit {
+			limit = n
+		}
+	}
+	samples := pcm.First(render, limit)
+	if stream != nil {
+		return samples, rate, stream.Err()
+	}
+	return samples, rate, nil
+}
+
+// frameVerb matches the frame number in a RunWriteToDisk path.
+var frameVerb = regexp.MustCompile(`%[0-9]*d`)
+
+// musicExportPath returns the path of the WAV file written next to frames.
+// "out/frame%05d.png" will return "out/frame.wav".
+func musicExportPath(framePath string) string {
+	p := strings.TrimSuffix(framePath, filepath.Ext(framePath))
+	p = strings.TrimRight(frameVerb.ReplaceAllString(p, ""), "_-. ")
+	if p == "" || strings.HasSuffix(p, "/") || strings.HasSuffix(p, string(filepath.Separator)) {
+		p += "music"
+	}
+	return p + ".wav"
+}
+
+// writeMusicWAV decodes the music and writes the first d of it as a 16 bit WAV file.
+// If the music is shorter, it is padded with silence.
+func writeMusicWAV(musicFile, dst string, d time.Duration) error {
+	samples, rate, err := decodeMusicSamples(musicFile, d)
+	if err != nil {
+		return err
+	}
+	n := int(int64(d) * int64(rate) / int64(time.Second))
+	if n > len(samples) {
+		samples = append(samples, make([][2]float64, n-len(samples))...)
+	}
+	data := wavBytes(samplesToPCM(samples[:n]), rate)
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, 0666)
+}
@@ -0,0 +1,92 @@
+package gfx
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/gfx/tracker"
+)
+
+// ModulePlayer plays MOD and XM modules.
+// It implements MusicPlayer and Analyzer and records the rows as they are played,
+// so effects can sync to the pattern data.
+// Use Music to get the player used by RunTimedMusic.
+type ModulePlayer struct {
+	Module *tracker.Module
+
+	mu   sync.Mutex
+	rows []tracker.RowInfo
+
+	renderedMusic
+}
+
+func newModulePlayer(m *tracker.Module) *ModulePlayer {
+	mp := &ModulePlayer{Module: m}
+	mp.restart = func() func(buf [][2]float64) int {
+		p := tracker.NewPlayer(m, renderSampleRate)
+		p.OnRow = func(r tracker.RowInfo) {
+			mp.mu.Lock()
+			// Rows rendered again after a seek are already recorded.
+			if len(mp.rows) == 0 || r.Sample > mp.rows[len(mp.rows)-1].Sample {
+				mp.rows = append(mp.rows, r)
+			}
+			mp.mu.Unlock()
+		}
+		return p.Render
+	}
+	mp.render = mp.restart()
+	return mp
+}
+
+// Row returns the row playing now.
+// false is returned if playback hasn't reached the first row.
+func (m *ModulePlayer) Row() (tracker.RowInfo, bool) {
+	return m.RowAt(m.Pos())
+}
+
+// RowAt returns the row playing at position d.
+// Only rows that have been rendered can be returned.
+func (m *ModulePlayer) RowAt(d time.Duration) (tracker.RowInfo, bool) {
+	s := durToSamples(d)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.rows), func(i int) bool { return m.rows[i].Sample > s })
+	if i == 0 {
+		return tracker.RowInfo{}, false
+	}
+	return m.rows[i-1], true
+}
+
+// Events returns the note events of rows starting after from and up to and including to.
+func (m *ModulePlayer) Events(from, to time.Duration) []tracker.NoteEvent {
+	f, t := durToSamples(from), durToSamples(to)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.rows), func(i int) bool { return m.rows[i].Sample > f })
+	var res []tracker.NoteEvent
+	for ; i < len(m.rows) && m.rows[i].Sample <= t; i++ {
+		res = append(res, m.rows[i].Events...)
+	}
+	return res
+}
+
+// LoadModule loads a MOD or XM module for playback.
+func LoadModule(path string) (*ModulePlayer, error) {
+	b, err := readMusic(path)
+	if err != nil {
+		return nil, err
+	}
+	return openModule(b)
+}
+
+func openModule(b []byte) (*ModulePlayer, error) {
+	mod, err := tracker.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	m := newModulePlayer(mod)
+	fmt.Printf("Playing %s module %q\n", mod.Format, mod.Title)
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package gfx
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/klauspost/gfx/internal/pcm"
+)
+
+// renderSampleRate is the sample rate music rendered in Go is played at.
+const renderSampleRate = 44100
+
+// renderedMusic plays music rendered by Go code, like modules and synth songs.
+// It implements Start, Pos and Analyze for the players embedding it.
+type renderedMusic struct {
+	render func(buf [][2]float64) int
+
+	// restart returns a new renderer starting at the beginning of the music.
+	// It may be called while render is used.
+	restart func() func(buf [][2]float64) int
+
+	clock musicClock
+
+	*audioAnalyzer
+
+	// Backend specific state.
+	renderBackend
+}
+
+func durToSamples(d time.Duration) int64 {
+	return int64(d) * renderSampleRate / int64(time.Second)
+}
+
+// samplesToPCM converts samples to interleaved 16 bit stereo samples.
+func samplesToPCM(samples [][2]float64) []int16 {
+	res := make([]int16, len(samples)*2)
+	for i, s := range samples {
+		for c, v := range s {
+			res[i*2+c] = pcm.ToInt16(v)
+		}
+	}
+	return res
+}
+
+func clampF(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// wavHeaderSize is the size of the header written by putWAVHeader.
+const wavHeaderSize = 44
+
+// wavBytes returns interleaved 16 bit stereo samples as a WAV file.
+func wavBytes(pcm []int16, sampleRate int) []byte {
+	b := make([]byte, wavHeaderSize+len(pcm)*2)
+	for i, v := range pcm {
+		binary.LittleEndian.PutUint16(b[wavHeaderSize+i*2:], uint16(v))
+	}
+	putWAVHeader(b, sampleRate)
+	return b
+}
+
+// putWAVHeader writes the header of a 16 bit stereo WAV file to b.
+// b must contain the header followed by the samples.
+func putWAVHeader(b []byte, sampleRate int) {
+	le := binary.LittleEndian
+	copy(b[0:], "RIFF")
+	le.PutUint32(b[4:], uint32(len(b)-8))
+	copy(b[8:], "WAVEfmt ")
+	le.PutUint32(b[16:], 16)
+	le.PutUint16(b[20:], 1) // PCM
+	le.PutUint16(b[22:], 2)
+	le.PutUint32(b[24:], uint32(sampleRate))
+	le.PutUint32(b[28:], uint32(sampleRate*4))
+	le.PutUint16(b[32:], 4)
+	le.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	le.PutUint32(b[40:], uint32(len(b)-wavHeaderSize))
+}
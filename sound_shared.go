@@ -6,3 +6,26 @@ type MusicPlayer interface {
 	Start(func(duration time.Duration))
 	Pos() time.Duration
 }
+
+// PlayOptions controls how a sound effect is played.
+type PlayOptions struct {
+	// Volume is 0 -> 1. Pan is -1 (left) -> 1 (right).
+	Volume, Pan float64
+
+	// Loop the sound until it is stopped.
+	Loop bool
+}
+
+// DefaultPlay plays a sound once at full volume.
+var DefaultPlay = PlayOptions{Volume: 1}
+
+// voiceGains returns the left and right gain for a volume and pan.
+func voiceGains(volume, pan float64) (l, r float64) {
+	l, r = volume, volume
+	if pan > 0 {
+		l *= 1 - pan
+	} else {
+		r *= 1 + pan
+	}
+	return l, r
+}
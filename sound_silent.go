@@ -0,0 +1,82 @@
+package gfx
+
+import (
+	"sync"
+	"time"
+)
+
+// SilentPlayer is a MusicPlayer without sound.
+// The clock runs in real time multiplied by the speed,
+// and can be moved manually, for example in tests.
+type SilentPlayer struct {
+	mu      sync.Mutex
+	started bool
+	base    time.Duration
+	since   time.Time
+	speed   float64
+	now     func() time.Time
+}
+
+// NewSilentPlayer returns a silent player running at normal speed.
+func NewSilentPlayer() *SilentPlayer {
+	return &SilentPlayer{speed: 1, now: time.Now}
+}
+
+func (s *SilentPlayer) Start(cb func(duration time.Duration)) {
+	s.mu.Lock()
+	s.started = true
+	s.since = s.now()
+	s.mu.Unlock()
+	cb(0)
+}
+
+// pos returns the position. s.mu must be held.
+func (s *SilentPlayer) pos() time.Duration {
+	if !s.started {
+		return s.base
+	}
+	return s.base + time.Duration(float64(s.now().Sub(s.since))*s.speed)
+}
+
+func (s *SilentPlayer) Pos() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pos()
+	if lp, loop := loopedPos(p); loop {
+		s.base, s.since = lp, s.now()
+		p = lp
+	}
+	return p
+}
+
+// SetSpeed sets how fast the clock runs compared to real time.
+// Use 0 to stop the clock, so it only moves by Advance and Seek.
+func (s *SilentPlayer) SetSpeed(speed float64) {
+	s.mu.Lock()
+	s.base, s.since = s.pos(), s.now()
+	s.speed = speed
+	s.mu.Unlock()
+}
+
+// Advance moves the clock forward by d.
+func (s *SilentPlayer) Advance(d time.Duration) {
+	s.mu.Lock()
+	s.base += d
+	s.mu.Unlock()
+}
+
+// Seek sets the clock to pos.
+func (s *SilentPlayer) Seek(pos time.Duration) {
+	s.mu.Lock()
+	s.base, s.since = pos, s.now()
+	s.mu.Unlock()
+}
+
+// silentMusic is set by SilentMusic.
+var silentMusic bool
+
+// SilentMusic makes RunTimedMusic use a SilentPlayer instead of playing the music.
+// A SilentPlayer is also used if no audio device is available.
+func SilentMusic(b bool) {
+	silentMusic = b
+}
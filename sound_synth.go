@@ -0,0 +1,96 @@
+package gfx
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/gfx/synth"
+)
+
+// SynthPlayer plays a synth song.
+// It implements MusicPlayer and Analyzer and records the rows as they are played,
+// so effects can sync to the notes.
+// Use Music to get the player used by RunTimedMusic.
+type SynthPlayer struct {
+	Song *synth.Song
+
+	mu    sync.Mutex
+	steps []synth.StepInfo
+
+	renderedMusic
+}
+
+// NewSynthPlayer returns a player for a song.
+// Use RunTimedMusicPlayer to play it.
+// Audio output is opened when the music is played,
+// so no error is returned if no audio device is available.
+func NewSynthPlayer(song *synth.Song) (*SynthPlayer, error) {
+	sp := &SynthPlayer{Song: song}
+	sp.restart = func() func(buf [][2]float64) int {
+		p := synth.NewPlayer(song, renderSampleRate)
+		p.OnStep = func(s synth.StepInfo) {
+			sp.mu.Lock()
+			// Rows rendered again after a seek are already recorded.
+			if len(sp.steps) == 0 || s.Sample > sp.steps[len(sp.steps)-1].Sample {
+				sp.steps = append(sp.steps, s)
+			}
+			sp.mu.Unlock()
+		}
+		return p.Render
+	}
+	sp.render = sp.restart()
+	return sp, nil
+}
+
+// LoadSynth loads a song in the synth text format for playback.
+// See synth.Parse for the format.
+func LoadSynth(path string) (*SynthPlayer, error) {
+	b, err := readMusic(path)
+	if err != nil {
+		return nil, err
+	}
+	return openSynth(b)
+}
+
+func openSynth(b []byte) (*SynthPlayer, error) {
+	song, err := synth.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Playing synth song with %d patterns\n", len(song.Order))
+	return NewSynthPlayer(song)
+}
+
+// Step returns the row playing now.
+// false is returned if playback hasn't reached the first row.
+func (s *SynthPlayer) Step() (synth.StepInfo, bool) {
+	return s.StepAt(s.Pos())
+}
+
+// StepAt returns the row playing at position d.
+// Only rows that have been rendered can be returned.
+func (s *SynthPlayer) StepAt(d time.Duration) (synth.StepInfo, bool) {
+	n := durToSamples(d)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.steps), func(i int) bool { return s.steps[i].Sample > n })
+	if i == 0 {
+		return synth.StepInfo{}, false
+	}
+	return s.steps[i-1], true
+}
+
+// Events returns the note events of rows starting after from and up to and including to.
+func (s *SynthPlayer) Events(from, to time.Duration) []synth.NoteEvent {
+	f, t := durToSamples(from), durToSamples(to)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.steps), func(i int) bool { return s.steps[i].Sample > f })
+	var res []synth.NoteEvent
+	for ; i < len(s.steps) && s.steps[i].Sample <= t; i++ {
+		res = append(res, s.steps[i].Events...)
+	}
+	return res
+}
@@ -3,27 +3,135 @@
 package gfx
 
 import (
+	"encoding/binary"
 	"fmt"
+	"path"
+	"strings"
+	"syscall/js"
 	"time"
+
+	"github.com/klauspost/gfx/internal/pcm"
+	"github.com/klauspost/gfx/tracker"
 )
 
 type soundPlayer struct {
-	s         jsObject
-	startedAt time.Time
+	s     jsObject
+	clock musicClock
 }
 
-func loadMusic(path string) (MusicPlayer, error) {
+func loadMusic(name string) (MusicPlayer, error) {
 	m := soundPlayer{s: getElementById("sound")}
+	// If a loader has the file, play it from memory.
+	// Otherwise we use the source of the element.
+	if b, err := Load(name); err == nil {
+		if tracker.Detect(b) != "" {
+			return openModule(b)
+		}
+		if strings.EqualFold(path.Ext(name), ".synth") {
+			return openSynth(b)
+		}
+		setBlobSource(m.s, b)
+	}
 	return &m, nil
 }
 
+// setBlobSource makes the element play b.
+func setBlobSource(s jsObject, b []byte) {
+	arr := js.TypedArrayOf(b)
+	blob := Global.Get("Blob").New([]interface{}{arr})
+	arr.Release()
+	s.Set("src", Global.Get("URL").Call("createObjectURL", blob))
+}
+
 func (m *soundPlayer) Start(cb func(duration time.Duration)) {
-	m.startedAt = time.Now()
+	m.clock.start()
 	res := m.s.Call("play")
 	fmt.Printf("%+v, %#v\n", res, res)
 	cb(0)
 }
 
 func (m *soundPlayer) Pos() time.Duration {
-	return time.Since(m.startedAt)
+	return updateElement(m.s, &m.clock)
+}
+
+// updateElement applies the loop and volume to the sound element
+// and returns the position of the music.
+func updateElement(s jsObject, c *musicClock) time.Duration {
+	p := c.pos()
+	if lp, loop := loopedPos(p); loop {
+		s.Set("currentTime", lp.Seconds())
+		c.set(lp)
+		p = lp
+	}
+	s.Set("volume", musicGain(p))
+	return p
+}
+
+// readMusic reads the music using Load.
+func readMusic(path string) ([]byte, error) {
+	return Load(path)
+}
+
+// renderBackend plays rendered music using the sound element.
+type renderBackend struct {
+	s jsObject
+}
+
+// renderYield is how long open renders before letting the browser handle events.
+const renderYield = 50 * time.Millisecond
+
+// open renders the complete music to a WAV file,
+// which is played by the sound element.
+// Onsets are detected while rendering and the rest of
+// the analysis reads the samples from the WAV file.
+// Rendering is done in chunks, so the page stays responsive.
+// Nothing is done if the music is open already.
+func (r *renderedMusic) open() error {
+	if r.audioAnalyzer != nil {
+		return nil
+	}
+	a := newAudioAnalyzer(renderSampleRate, int(durToSamples(analysisBuffer)))
+	b := make([]byte, wavHeaderSize)
+	last := time.Now()
+	pcm.Each(r.render, renderSampleRate, func(block [][2]float64) {
+		for _, s := range block {
+			left, right := uint16(pcm.ToInt16(s[0])), uint16(pcm.ToInt16(s[1]))
+			b = append(b, byte(left), byte(left>>8), byte(right), byte(right>>8))
+		}
+		a.write(block)
+		if time.Since(last) > renderYield {
+			// Sleeping returns to the event loop, so the page isn't blocked.
+			time.Sleep(time.Millisecond)
+			last = time.Now()
+		}
+	})
+	putWAVHeader(b, renderSampleRate)
+	r.s = getElementById("sound")
+	setBlobSource(r.s, b)
+
+	data := b[wavHeaderSize:]
+	a.read = func(s int64) float64 {
+		if s >= int64(len(data)/4) {
+			return 0
+		}
+		p := data[s*4:]
+		left, right := int16(binary.LittleEndian.Uint16(p)), int16(binary.LittleEndian.Uint16(p[2:]))
+		return (float64(left) + float64(right)) / 2 / 32768
+	}
+	r.audioAnalyzer = a
+	return nil
+}
+
+// Start renders the music if RunTimedMusicPlayer hasn't, and starts it.
+func (r *renderedMusic) Start(cb func(duration time.Duration)) {
+	if err := r.open(); err != nil {
+		panic(err)
+	}
+	r.clock.start()
+	r.s.Call("play")
+	cb(0)
+}
+
+func (r *renderedMusic) Pos() time.Duration {
+	return updateElement(r.s, &r.clock)
 }
@@ -0,0 +1,249 @@
+package synth
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse a song in the text format:
+//
+//	# Words starting with '#' begin a comment.
+//	bpm 125
+//	rows 4    # Rows per beat.
+//	instrument bass wave=saw attack=0.01 decay=0.2 sustain=0.5 release=0.1 filter=lp cutoff=400 resonance=0.5 envmod=2000
+//	instrument lead wave=square volume=0.6 pan=0.3 detune=0.05
+//	delay time=0.375 feedback=0.4 mix=0.3
+//	reverb size=0.8 damp=0.3 mix=0.2
+//	pattern intro
+//	bass C-2 . . . C-2 . off . D#2 . . . G-1 . . .
+//	lead C-5:0.5 . . . . . . . G-4 . . . . . . .
+//	end
+//	order intro intro
+//
+// Instrument keys are wave (sine, square, saw, triangle, noise), volume, pan, detune,
+// attack, decay, sustain, release, filter (lp, hp, bp, none), cutoff, resonance and envmod.
+// Instruments default to full volume and sustain.
+//
+// Pattern lines start with an instrument name followed by steps.
+// See ParseSteps for the step format.
+func Parse(b []byte) (*Song, error) {
+	s := &Song{BPM: 120, RowsPerBeat: 4}
+	instruments := map[string]int{}
+	patterns := map[string]int{}
+	var pat *Pattern
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	line := 0
+	for sc.Scan() {
+		line++
+		f := strings.Fields(sc.Text())
+		for i, v := range f {
+			if strings.HasPrefix(v, "#") {
+				f = f[:i]
+				break
+			}
+		}
+		if len(f) == 0 {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("synth: line %d: %s", line, fmt.Sprintf(format, args...))
+		}
+		if pat != nil {
+			if f[0] == "end" {
+				pat = nil
+				continue
+			}
+			idx, ok := instruments[f[0]]
+			if !ok {
+				return nil, fail("unknown instrument %q", f[0])
+			}
+			steps, err := ParseSteps(strings.Join(f[1:], " "))
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			pat.Tracks = append(pat.Tracks, Track{Instrument: idx, Steps: steps})
+			continue
+		}
+		args := f[1:]
+		switch f[0] {
+		case "bpm":
+			v, err := oneFloat(args)
+			if err != nil || v <= 0 {
+				return nil, fail("invalid bpm")
+			}
+			s.BPM = v
+		case "rows":
+			v, err := oneFloat(args)
+			if err != nil || v < 1 {
+				return nil, fail("invalid rows")
+			}
+			s.RowsPerBeat = int(v)
+		case "instrument":
+			if len(args) == 0 {
+				return nil, fail("instrument needs a name")
+			}
+			inst, err := parseInstrument(args[0], args[1:])
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			instruments[inst.Name] = len(s.Instruments)
+			s.Instruments = append(s.Instruments, inst)
+		case "delay":
+			err := parseValues(args, map[string]*float64{
+				"time": &s.Delay.Time, "feedback": &s.Delay.Feedback, "mix": &s.Delay.Mix,
+			})
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+		case "reverb":
+			err := parseValues(args, map[string]*float64{
+				"size": &s.Reverb.Size, "damp": &s.Reverb.Damp, "mix": &s.Reverb.Mix,
+			})
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+		case "pattern":
+			if len(args) != 1 {
+				return nil, fail("pattern needs a name")
+			}
+			pat = &Pattern{Name: args[0]}
+			patterns[pat.Name] = len(s.Patterns)
+			s.Patterns = append(s.Patterns, pat)
+		case "order":
+			for _, name := range args {
+				idx, ok := patterns[name]
+				if !ok {
+					return nil, fail("unknown pattern %q", name)
+				}
+				s.Order = append(s.Order, idx)
+			}
+		default:
+			return nil, fail("unknown command %q", f[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if pat != nil {
+		return nil, fmt.Errorf("synth: pattern %q has no end", pat.Name)
+	}
+	return s, nil
+}
+
+func oneFloat(args []string) (float64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected one value")
+	}
+	return strconv.ParseFloat(args[0], 64)
+}
+
+// parseValues parses key=value arguments into floats.
+func parseValues(args []string, dst map[string]*float64) error {
+	for _, a := range args {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value, got %q", a)
+		}
+		p, ok := dst[kv[0]]
+		if !ok {
+			return fmt.Errorf("unknown key %q", kv[0])
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return fmt.Errorf("%s: %v", kv[0], err)
+		}
+		*p = v
+	}
+	return nil
+}
+
+func parseInstrument(name string, args []string) (*Instrument, error) {
+	inst := &Instrument{Name: name, Volume: 1, Env: ADSR{Sustain: 1}}
+	values := map[string]*float64{
+		"volume": &inst.Volume, "pan": &inst.Pan, "detune": &inst.Detune,
+		"attack": &inst.Env.Attack, "decay": &inst.Env.Decay,
+		"sustain": &inst.Env.Sustain, "release": &inst.Env.Release,
+		"cutoff": &inst.Cutoff, "resonance": &inst.Resonance, "envmod": &inst.EnvMod,
+	}
+	var rest []string
+	for _, a := range args {
+		kv := strings.SplitN(a, "=", 2)
+		switch {
+		case len(kv) == 2 && kv[0] == "wave":
+			w, ok := map[string]Waveform{"sine": Sine, "square": Square, "saw": Saw, "triangle": Triangle, "noise": Noise}[kv[1]]
+			if !ok {
+				return nil, fmt.Errorf("unknown wave %q", kv[1])
+			}
+			inst.Wave = w
+		case len(kv) == 2 && kv[0] == "filter":
+			t, ok := map[string]FilterType{"none": NoFilter, "lp": LowPass, "hp": HighPass, "bp": BandPass}[kv[1]]
+			if !ok {
+				return nil, fmt.Errorf("unknown filter %q", kv[1])
+			}
+			inst.Filter = t
+		default:
+			rest = append(rest, a)
+		}
+	}
+	if err := parseValues(rest, values); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// ParseSteps parses space separated steps.
+// A step is a note like "C-4" or "F#2", "off" to release the note,
+// or "." for no change.
+// A velocity can be added to notes, like "C-4:0.5".
+func ParseSteps(s string) ([]Step, error) {
+	var steps []Step
+	for _, f := range strings.Fields(s) {
+		st, err := parseStep(f)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, st)
+	}
+	return steps, nil
+}
+
+func parseStep(s string) (Step, error) {
+	switch s {
+	case ".", "...", "---":
+		return Step{}, nil
+	case "off", "===":
+		return Step{Note: NoteOff}, nil
+	}
+	var st Step
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		v, err := strconv.ParseFloat(s[i+1:], 64)
+		if err != nil || v < 0 || v > 1 {
+			return st, fmt.Errorf("invalid velocity in %q", s)
+		}
+		st.Velocity = v
+		s = s[:i]
+	}
+	if len(s) != 3 {
+		return st, fmt.Errorf("invalid note %q", s)
+	}
+	semi := strings.IndexByte("C D EF G A B", s[0])
+	if semi < 0 || s[0] == ' ' {
+		return st, fmt.Errorf("invalid note %q", s)
+	}
+	switch s[1] {
+	case '-':
+	case '#':
+		semi++
+	default:
+		return st, fmt.Errorf("invalid note %q", s)
+	}
+	if s[2] < '0' || s[2] > '9' {
+		return st, fmt.Errorf("invalid octave in %q", s)
+	}
+	// C-4 is MIDI note 60.
+	st.Note = 12*(int(s[2]-'0')+1) + semi
+	return st, nil
+}
@@ -0,0 +1,407 @@
+package synth
+
+import (
+	"math"
+
+	"github.com/klauspost/gfx/internal/pcm"
+)
+
+// NoteEvent is a note or note off played by a track.
+type NoteEvent struct {
+	Track, Instrument int
+	Note              int
+	Velocity          float64
+}
+
+// StepInfo describes a row as it starts playing.
+type StepInfo struct {
+	// Order is the index in Song.Order and Pattern the pattern played.
+	Order, Pattern, Row int
+
+	// Sample is the number of samples rendered by the player before the row starts.
+	Sample int64
+
+	// Events contains the notes and note offs of the row.
+	Events []NoteEvent
+}
+
+// maxVoices limits the number of voices playing at once.
+const maxVoices = 64
+
+// Player renders a song.
+type Player struct {
+	song       *Song
+	sampleRate float64
+
+	// Loop will make the song restart when it ends.
+	// Otherwise Render will stop after the last row.
+	Loop bool
+
+	// OnStep is called when a row starts, before any samples of the row are rendered.
+	OnStep func(s StepInfo)
+
+	order, row int
+	rowLeft    float64
+	rendered   int64
+	ended      bool
+	voices     []*voice
+	tracks     []*voice
+	noise      uint32
+	delay      delayLine
+	reverb     [2]reverbChannel
+}
+
+// NewPlayer returns a player that renders the song with the given sample rate.
+func NewPlayer(s *Song, sampleRate int) *Player {
+	p := &Player{
+		song:       s,
+		sampleRate: float64(sampleRate),
+		noise:      0x12345678,
+		ended:      len(s.Order) == 0 || s.BPM <= 0,
+	}
+	if s.Delay.Mix > 0 && s.Delay.Time > 0 {
+		n := int(s.Delay.Time * p.sampleRate)
+		if n < 1 {
+			n = 1
+		}
+		p.delay = delayLine{l: make([]float64, n), r: make([]float64, n)}
+	}
+	if s.Reverb.Mix > 0 {
+		p.reverb[0] = newReverbChannel(sampleRate, 0)
+		p.reverb[1] = newReverbChannel(sampleRate, 23)
+	}
+	return p
+}
+
+// Ended returns true if the song has ended.
+func (p *Player) Ended() bool {
+	return p.ended
+}
+
+// Render stereo samples into buf.
+// The number of samples rendered is returned,
+// which is less than len(buf) only when the song has ended.
+func (p *Player) Render(buf [][2]float64) int {
+	rows := p.song.RowsPerBeat
+	if rows < 1 {
+		rows = 1
+	}
+	rowLen := p.sampleRate * 60 / (p.song.BPM * float64(rows))
+	n := 0
+	for n < len(buf) {
+		if p.rowLeft <= 0 {
+			if p.ended {
+				break
+			}
+			p.startRow()
+			if p.ended {
+				break
+			}
+			p.rowLeft += rowLen
+		}
+		todo := int(math.Ceil(p.rowLeft))
+		if todo > len(buf)-n {
+			todo = len(buf) - n
+		}
+		p.mix(buf[n : n+todo])
+		p.rowLeft -= float64(todo)
+		p.rendered += int64(todo)
+		n += todo
+	}
+	return n
+}
+
+// startRow plays the notes of the current row and advances to the next.
+func (p *Player) startRow() {
+	s := p.song
+	if p.order >= len(s.Order) {
+		if !p.Loop {
+			p.ended = true
+			return
+		}
+		p.order = 0
+	}
+	pi := s.Order[p.order]
+	var pat *Pattern
+	if pi >= 0 && pi < len(s.Patterns) {
+		pat = s.Patterns[pi]
+	}
+	info := StepInfo{Order: p.order, Pattern: pi, Row: p.row, Sample: p.rendered}
+	if pat != nil {
+		for len(p.tracks) < len(pat.Tracks) {
+			p.tracks = append(p.tracks, nil)
+		}
+		for ti, t := range pat.Tracks {
+			if p.row >= len(t.Steps) || t.Steps[p.row].Note == NoNote {
+				continue
+			}
+			st := t.Steps[p.row]
+			info.Events = append(info.Events, NoteEvent{Track: ti, Instrument: t.Instrument, Note: st.Note, Velocity: st.Velocity})
+			if v := p.tracks[ti]; v != nil {
+				v.release()
+				p.tracks[ti] = nil
+			}
+			if st.Note == NoteOff || t.Instrument < 0 || t.Instrument >= len(s.Instruments) {
+				continue
+			}
+			p.tracks[ti] = p.noteOn(s.Instruments[t.Instrument], st)
+		}
+	}
+	if p.OnStep != nil {
+		p.OnStep(info)
+	}
+	p.row++
+	if pat == nil || p.row >= pat.Rows() {
+		p.row = 0
+		p.order++
+	}
+}
+
+func (p *Player) noteOn(inst *Instrument, st Step) *voice {
+	vel := st.Velocity
+	if vel == 0 {
+		vel = 1
+	}
+	v := &voice{
+		inst:     inst,
+		freq:     NoteFreq(float64(st.Note) + inst.Detune),
+		velocity: vel,
+		stage:    stageAttack,
+	}
+	if len(p.voices) >= maxVoices {
+		// Steal the oldest voice.
+		p.voices = p.voices[1:]
+	}
+	p.voices = append(p.voices, v)
+	return v
+}
+
+// mix renders the voices and effects into out.
+func (p *Player) mix(out [][2]float64) {
+	for i := range out {
+		out[i] = [2]float64{}
+	}
+	live := p.voices[:0]
+	for _, v := range p.voices {
+		v.render(out, p)
+		if v.stage != stageDone {
+			live = append(live, v)
+		}
+	}
+	for i := len(live); i < len(p.voices); i++ {
+		p.voices[i] = nil
+	}
+	p.voices = live
+
+	s := p.song
+	for i := range out {
+		l, r := out[i][0], out[i][1]
+		if len(p.delay.l) > 0 {
+			dl, dr := p.delay.l[p.delay.pos], p.delay.r[p.delay.pos]
+			p.delay.l[p.delay.pos] = l + dl*s.Delay.Feedback
+			p.delay.r[p.delay.pos] = r + dr*s.Delay.Feedback
+			p.delay.pos = (p.delay.pos + 1) % len(p.delay.l)
+			l += dl * s.Delay.Mix
+			r += dr * s.Delay.Mix
+		}
+		if s.Reverb.Mix > 0 {
+			in := (l + r) * 0.5
+			l += p.reverb[0].process(in, s.Reverb) * s.Reverb.Mix
+			r += p.reverb[1].process(in, s.Reverb) * s.Reverb.Mix
+		}
+		out[i][0] = math.Max(-1, math.Min(1, l))
+		out[i][1] = math.Max(-1, math.Min(1, r))
+	}
+}
+
+// nextNoise returns deterministic white noise, -1 -> 1.
+func (p *Player) nextNoise() float64 {
+	// xorshift32
+	x := p.noise
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	p.noise = x
+	return float64(x)/float64(1<<31) - 1
+}
+
+const (
+	stageAttack = iota
+	stageDecay
+	stageSustain
+	stageRelease
+	stageDone
+)
+
+type voice struct {
+	inst     *Instrument
+	freq     float64
+	velocity float64
+	phase    float64
+
+	stage int
+	level float64
+	relAt float64 // Level when released.
+
+	// State variable filter.
+	low, band float64
+}
+
+func (v *voice) release() {
+	if v.stage < stageRelease {
+		v.stage = stageRelease
+		v.relAt = v.level
+	}
+}
+
+// envelope advances the envelope a single sample.
+func (v *voice) envelope(sampleRate float64) {
+	env := v.inst.Env
+	switch v.stage {
+	case stageAttack:
+		if env.Attack <= 0 {
+			v.level = 1
+		} else {
+			v.level += 1 / (env.Attack * sampleRate)
+		}
+		if v.level >= 1 {
+			v.level = 1
+			v.stage = stageDecay
+		}
+	case stageDecay:
+		if env.Decay <= 0 {
+			v.level = env.Sustain
+		} else {
+			v.level -= (1 - env.Sustain) / (env.Decay * sampleRate)
+		}
+		if v.level <= env.Sustain {
+			v.level = env.Sustain
+			v.stage = stageSustain
+		}
+	case stageRelease:
+		if env.Release <= 0 {
+			v.level = 0
+		} else {
+			v.level -= v.relAt / (env.Release * sampleRate)
+		}
+		if v.level <= 0 {
+			v.level = 0
+			v.stage = stageDone
+		}
+	}
+	if v.stage == stageSustain && env.Sustain <= 0 {
+		v.stage = stageDone
+	}
+}
+
+func (v *voice) render(out [][2]float64, p *Player) {
+	inst := v.inst
+	step := v.freq / p.sampleRate
+	gainL := inst.Volume * v.velocity * math.Min(1, 1-inst.Pan) * 0.5
+	gainR := inst.Volume * v.velocity * math.Min(1, 1+inst.Pan) * 0.5
+	for i := range out {
+		if v.stage == stageDone {
+			return
+		}
+		var s float64
+		switch inst.Wave {
+		case Sine:
+			s = math.Sin(2 * math.Pi * v.phase)
+		case Square:
+			s = 1
+			if v.phase >= 0.5 {
+				s = -1
+			}
+		case Saw:
+			s = 2*v.phase - 1
+		case Triangle:
+			s = 4*math.Abs(v.phase-0.5) - 1
+		case Noise:
+			s = p.nextNoise()
+		}
+		v.phase += step
+		v.phase -= math.Floor(v.phase)
+
+		if inst.Filter != NoFilter {
+			cutoff := inst.Cutoff + inst.EnvMod*v.level
+			// Keep the filter stable.
+			cutoff = math.Max(10, math.Min(cutoff, p.sampleRate/6))
+			f := 2 * math.Sin(math.Pi*cutoff/p.sampleRate)
+			q := 1 - math.Min(inst.Resonance, 0.99)
+			v.low += f * v.band
+			high := s - v.low - q*v.band
+			v.band += f * high
+			switch inst.Filter {
+			case LowPass:
+				s = v.low
+			case HighPass:
+				s = high
+			case BandPass:
+				s = v.band
+			}
+		}
+		v.envelope(p.sampleRate)
+		s *= v.level
+		out[i][0] += s * gainL
+		out[i][1] += s * gainR
+	}
+}
+
+type delayLine struct {
+	l, r []float64
+	pos  int
+}
+
+// reverbChannel is a Schroeder reverb with parallel combs and serial allpass filters.
+type reverbChannel struct {
+	combs   [4][]float64
+	combPos [4]int
+	store   [4]float64
+	allpass [2][]float64
+	apPos   [2]int
+}
+
+func newReverbChannel(sampleRate, spread int) reverbChannel {
+	var r reverbChannel
+	scale := func(n int) int {
+		return (n + spread) * sampleRate / 44100
+	}
+	for i, n := range [4]int{1116, 1188, 1277, 1356} {
+		r.combs[i] = make([]float64, scale(n))
+	}
+	for i, n := range [2]int{556, 441} {
+		r.allpass[i] = make([]float64, scale(n))
+	}
+	return r
+}
+
+func (r *reverbChannel) process(in float64, p Reverb) float64 {
+	feedback := 0.7 + 0.28*p.Size
+	in *= 0.03
+	var out float64
+	for i, buf := range r.combs {
+		y := buf[r.combPos[i]]
+		r.store[i] = y*(1-p.Damp) + r.store[i]*p.Damp
+		buf[r.combPos[i]] = in + r.store[i]*feedback
+		r.combPos[i] = (r.combPos[i] + 1) % len(buf)
+		out += y
+	}
+	for i, buf := range r.allpass {
+		b := buf[r.apPos[i]]
+		buf[r.apPos[i]] = out + b*0.5
+		r.apPos[i] = (r.apPos[i] + 1) % len(buf)
+		out = b - out
+	}
+	return out
+}
+
+// RenderPCM renders the rest of the song to interleaved 16 bit stereo samples.
+func (p *Player) RenderPCM() []int16 {
+	return pcm.Int16(p.Render, int(p.sampleRate))
+}
+
+// RenderPCM renders the song offline to interleaved 16 bit stereo samples.
+// The song is played once.
+func (s *Song) RenderPCM(sampleRate int) []int16 {
+	return NewPlayer(s, sampleRate).RenderPCM()
+}
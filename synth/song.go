@@ -0,0 +1,129 @@
+// Package synth is a small software synthesizer with a pattern sequencer
+// for procedural music.
+//
+// Songs can be described in Go or in a compact text format, see Parse.
+// Rendering is deterministic, so a song rendered offline
+// will always produce the same output.
+package synth
+
+import (
+	"math"
+)
+
+// Waveform of an oscillator.
+type Waveform int
+
+const (
+	Sine Waveform = iota
+	Square
+	Saw
+	Triangle
+	Noise
+)
+
+// FilterType is the type of filter applied to an instrument.
+type FilterType int
+
+const (
+	NoFilter FilterType = iota
+	LowPass
+	HighPass
+	BandPass
+)
+
+// ADSR is an envelope. Times are in seconds, Sustain is the level 0 -> 1.
+type ADSR struct {
+	Attack, Decay float64
+	Sustain       float64
+	Release       float64
+}
+
+// Instrument describes how notes are played.
+type Instrument struct {
+	Name string
+	Wave Waveform
+
+	// Detune in semitones.
+	Detune float64
+
+	// Volume is 0 -> 1 and Pan is -1 (left) -> 1 (right).
+	Volume, Pan float64
+
+	Env ADSR
+
+	// Filter with cutoff frequency in Hz and resonance 0 -> 1.
+	Filter            FilterType
+	Cutoff, Resonance float64
+
+	// EnvMod is added to the cutoff frequency, scaled by the envelope.
+	EnvMod float64
+}
+
+// Note values with special meaning.
+const (
+	NoNote  = 0
+	NoteOff = -1
+)
+
+// Step is a single step in a track.
+type Step struct {
+	// Note is a MIDI note number (69 is A-4, 440Hz), NoNote or NoteOff.
+	Note int
+
+	// Velocity is 0 -> 1. 0 means full velocity.
+	Velocity float64
+}
+
+// Track is a sequence of steps played by an instrument.
+type Track struct {
+	// Instrument is the index in Song.Instruments.
+	Instrument int
+	Steps      []Step
+}
+
+// Pattern is a number of tracks played together.
+type Pattern struct {
+	Name   string
+	Tracks []Track
+}
+
+// Rows returns the number of rows in the pattern.
+func (p *Pattern) Rows() int {
+	n := 0
+	for _, t := range p.Tracks {
+		if len(t.Steps) > n {
+			n = len(t.Steps)
+		}
+	}
+	return n
+}
+
+// Delay is an echo effect. Time is in seconds. A Mix of 0 disables it.
+type Delay struct {
+	Time, Feedback, Mix float64
+}
+
+// Reverb is a room effect. Size and Damp are 0 -> 1. A Mix of 0 disables it.
+type Reverb struct {
+	Size, Damp, Mix float64
+}
+
+// Song is a complete song.
+type Song struct {
+	BPM         float64
+	RowsPerBeat int
+
+	Instruments []*Instrument
+	Patterns    []*Pattern
+
+	// Order contains indexes in Patterns in the order they are played.
+	Order []int
+
+	Delay  Delay
+	Reverb Reverb
+}
+
+// NoteFreq returns the frequency of a MIDI note.
+func NoteFreq(note float64) float64 {
+	return 440 * math.Pow(2, (note-69)/12)
+}
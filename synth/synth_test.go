@@ -0,0 +1,71 @@
+package synth
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testSong = `bpm 125
+rows 4
+instrument bass wave=saw attack=0.01 decay=0.2 sustain=0.5 release=0.1 filter=lp cutoff=400 resonance=0.5 envmod=2000
+instrument lead wave=square volume=0.6 pan=0.3 detune=0.05
+instrument hat wave=noise decay=0.05 sustain=0 filter=hp cutoff=5000
+delay time=0.375 feedback=0.4 mix=0.3
+reverb size=0.8 damp=0.3 mix=0.2
+pattern intro
+bass C-2 . . . C-2 . off . D#2 . . . G-1 . . .
+lead C-5:0.5 . . . . . . . G-4 . . . . . . .
+hat C-4 . C-4 . C-4 . C-4 . C-4 . C-4 . C-4 . C-4 .
+end
+order intro intro
+`
+
+func TestRender(t *testing.T) {
+	s, err := Parse([]byte(testSong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := s.RenderPCM(44100)
+	b := s.RenderPCM(44100)
+	// 32 rows of 0.12 seconds.
+	if len(a) != 32*5292*2 {
+		t.Fatalf("got %d samples, want %d", len(a)/2, 32*5292)
+	}
+	if len(b) != len(a) {
+		t.Fatalf("second render has %d samples, want %d", len(b)/2, len(a)/2)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d differs: %d != %d", i/2, a[i], b[i])
+		}
+	}
+	// Other architectures may fuse floating point operations,
+	// so the output is only compared on amd64.
+	if runtime.GOARCH != "amd64" {
+		return
+	}
+	h := sha1.New()
+	binary.Write(h, binary.LittleEndian, a)
+	const want = "e839c2bdf36cef15b1af985ec4cc2e52fd0a1379"
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("got hash %s, want %s", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, tc := range []struct{ song, err string }{
+		{"pattern x\nfoo C-4\nend", "line 2"},
+		{"instrument a wave=organ", "unknown wave"},
+		{"instrument a\npattern x\na H-4\nend", "invalid note"},
+		{"instrument a\npattern x\na C-4", "has no end"},
+	} {
+		_, err := Parse([]byte(tc.song))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: got error %v, want %q", tc.song, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package gfx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+func init() {
+	// TGA has no magic, so we match the colour map and image type.
+	for _, magic := range []string{"?\x01\x01", "?\x01\x09", "?\x00\x02", "?\x00\x0a", "?\x00\x03", "?\x00\x0b"} {
+		image.RegisterFormat("tga", magic, decodeTGA, decodeTGAConfig)
+	}
+}
+
+const (
+	tgaColorMapped = 1
+	tgaTrueColor   = 2
+	tgaGrey        = 3
+	tgaRLE         = 8
+
+	tgaRightToLeft = 0x10
+	tgaTopToBottom = 0x20
+)
+
+type tgaHeader struct {
+	IDLength      uint8
+	ColorMapType  uint8
+	ImageType     uint8
+	CMapFirst     uint16
+	CMapLength    uint16
+	CMapEntrySize uint8
+	XOrigin       uint16
+	YOrigin       uint16
+	Width         uint16
+	Height        uint16
+	PixelDepth    uint8
+	Descriptor    uint8
+}
+
+var errTGA = errors.New("tga: invalid format")
+
+func readTGAHeader(r io.Reader) (*tgaHeader, error) {
+	var h tgaHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Width == 0 || h.Height == 0 {
+		return nil, errTGA
+	}
+	switch h.ImageType &^ tgaRLE {
+	case tgaColorMapped:
+		if h.ColorMapType != 1 || h.PixelDepth != 8 || int(h.CMapFirst)+int(h.CMapLength) > 256 {
+			return nil, fmt.Errorf("tga: unsupported colour map, %d bits, %d entries", h.PixelDepth, int(h.CMapFirst)+int(h.CMapLength))
+		}
+	case tgaTrueColor:
+		if h.PixelDepth != 15 && h.PixelDepth != 16 && h.PixelDepth != 24 && h.PixelDepth != 32 {
+			return nil, fmt.Errorf("tga: unsupported depth %d", h.PixelDepth)
+		}
+	case tgaGrey:
+		if h.PixelDepth != 8 {
+			return nil, fmt.Errorf("tga: unsupported grey depth %d", h.PixelDepth)
+		}
+	default:
+		return nil, fmt.Errorf("tga: unsupported image type %d", h.ImageType)
+	}
+	return &h, nil
+}
+
+// tgaColor decodes a colour stored in b with the given depth.
+func tgaColor(b []byte, depth uint8, alpha bool) color.NRGBA {
+	switch depth {
+	case 15, 16:
+		v := uint16(b[0]) | uint16(b[1])<<8
+		c := color.NRGBA{
+			R: uint8(v>>10&31) << 3,
+			G: uint8(v>>5&31) << 3,
+			B: uint8(v&31) << 3,
+			A: 255,
+		}
+		c.R |= c.R >> 5
+		c.G |= c.G >> 5
+		c.B |= c.B >> 5
+		if alpha && depth == 16 && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 32:
+		c := color.NRGBA{R: b[2], G: b[1], B: b[0], A: b[3]}
+		if !alpha {
+			c.A = 255
+		}
+		return c
+	}
+	return color.NRGBA{R: b[2], G: b[1], B: b[0], A: 255}
+}
+
+func decodeTGAConfig(r io.Reader) (image.Config, error) {
+	br := bufio.NewReader(r)
+	h, err := readTGAHeader(br)
+	if err != nil {
+		return image.Config{}, err
+	}
+	cfg := image.Config{Width: int(h.Width), Height: int(h.Height), ColorModel: color.NRGBAModel}
+	switch h.ImageType &^ tgaRLE {
+	case tgaGrey:
+		cfg.ColorModel = color.GrayModel
+	case tgaColorMapped:
+		if _, err := io.CopyN(ioutil.Discard, br, int64(h.IDLength)); err != nil {
+			return cfg, err
+		}
+		pal, err := readTGAPalette(br, h)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ColorModel = pal
+	}
+	return cfg, nil
+}
+
+func readTGAPalette(r io.Reader, h *tgaHeader) (color.Palette, error) {
+	size := (int(h.CMapEntrySize) + 7) / 8
+	if size < 2 || size > 4 {
+		return nil, fmt.Errorf("tga: unsupported colour map entry size %d", h.CMapEntrySize)
+	}
+	b := make([]byte, size*int(h.CMapLength))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	// Entries before the first are unused.
+	pal := make(color.Palette, int(h.CMapFirst)+int(h.CMapLength))
+	for i := range pal {
+		pal[i] = color.NRGBA{A: 255}
+	}
+	for i := 0; i < int(h.CMapLength); i++ {
+		pal[int(h.CMapFirst)+i] = tgaColor(b[i*size:], h.CMapEntrySize, h.CMapEntrySize == 32 || h.CMapEntrySize == 16)
+	}
+	return pal, nil
+}
+
+func decodeTGA(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readTGAHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, br, int64(h.IDLength)); err != nil {
+		return nil, err
+	}
+	var pal color.Palette
+	if h.ColorMapType == 1 {
+		if h.ImageType&^tgaRLE == tgaColorMapped {
+			pal, err = readTGAPalette(br, h)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// Skip colour map of true colour images.
+			size := (int(h.CMapEntrySize) + 7) / 8
+			if _, err := io.CopyN(ioutil.Discard, br, int64(size*int(h.CMapLength))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w, ht := int(h.Width), int(h.Height)
+	bpp := (int(h.PixelDepth) + 7) / 8
+	// The buffer grows as data is read, so a bogus size fails at the end of the file.
+	size := w * ht * bpp
+	var raw []byte
+	if h.ImageType&tgaRLE == 0 {
+		raw, err = ioutil.ReadAll(io.LimitReader(br, int64(size)))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+	} else {
+		raw = make([]byte, 0, preallocSize(size))
+		px := make([]byte, bpp)
+		for len(raw) < size {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			n := int(b&0x7f) + 1
+			if n*bpp > size-len(raw) {
+				n = (size - len(raw)) / bpp
+			}
+			if b&0x80 != 0 {
+				if _, err := io.ReadFull(br, px); err != nil {
+					return nil, err
+				}
+				for ; n > 0; n-- {
+					raw = append(raw, px...)
+				}
+				continue
+			}
+			i := len(raw)
+			raw = append(raw, make([]byte, n*bpp)...)
+			if _, err := io.ReadFull(br, raw[i:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// srcRow returns the source row of output line y.
+	srcRow := func(y int) []byte {
+		if h.Descriptor&tgaTopToBottom == 0 {
+			y = ht - 1 - y
+		}
+		return raw[y*w*bpp : (y+1)*w*bpp]
+	}
+	srcX := func(x int) int {
+		if h.Descriptor&tgaRightToLeft != 0 {
+			return w - 1 - x
+		}
+		return x
+	}
+	rect := image.Rect(0, 0, w, ht)
+	switch h.ImageType &^ tgaRLE {
+	case tgaColorMapped:
+		img := image.NewPaletted(rect, pal)
+		for y := 0; y < ht; y++ {
+			row := srcRow(y)
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w]
+			for x := range dLine {
+				v := row[srcX(x)]
+				if int(v) >= len(pal) {
+					return nil, errTGA
+				}
+				dLine[x] = v
+			}
+		}
+		return img, nil
+	case tgaGrey:
+		img := image.NewGray(rect)
+		for y := 0; y < ht; y++ {
+			row := srcRow(y)
+			dLine := img.Pix[y*img.Stride : y*img.Stride+w]
+			for x := range dLine {
+				dLine[x] = row[srcX(x)]
+			}
+		}
+		return img, nil
+	}
+	alpha := h.Descriptor&15 != 0
+	img := image.NewNRGBA(rect)
+	for y := 0; y < ht; y++ {
+		row := srcRow(y)
+		dLine := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		for x := 0; x < w; x++ {
+			c := tgaColor(row[srcX(x)*bpp:], h.PixelDepth, alpha)
+			dLine[x*4+0] = c.R
+			dLine[x*4+1] = c.G
+			dLine[x*4+2] = c.B
+			dLine[x*4+3] = c.A
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,85 @@
+package gfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// tgaFile returns a TGA file with the header, colour map and image data.
+func tgaFile(h tgaHeader, cmap, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, h)
+	b.Write(cmap)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestDecodeTGA(t *testing.T) {
+	// 2x2 RLE true colour, stored bottom to top.
+	// The bottom row is a run of red, the top row is green and blue raw pixels.
+	h := tgaHeader{ImageType: tgaTrueColor | tgaRLE, Width: 2, Height: 2, PixelDepth: 24}
+	b := tgaFile(h, nil, []byte{0x81, 0, 0, 255, 0x01, 0, 255, 0, 255, 0, 0})
+	img, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "tga" {
+		t.Fatalf("got format %q", format)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{0, 0, color.NRGBA{G: 255, A: 255}},
+		{1, 0, color.NRGBA{B: 255, A: 255}},
+		{0, 1, color.NRGBA{R: 255, A: 255}},
+		{1, 1, color.NRGBA{R: 255, A: 255}},
+	} {
+		if got := img.At(tc.x, tc.y); got != tc.want {
+			t.Errorf("pixel %d,%d: got %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeTGAColorMapped(t *testing.T) {
+	h := tgaHeader{ColorMapType: 1, ImageType: tgaColorMapped, CMapLength: 2, CMapEntrySize: 24,
+		Width: 2, Height: 1, PixelDepth: 8, Descriptor: tgaTopToBottom}
+	b := tgaFile(h, []byte{0, 0, 0, 255, 255, 255}, []byte{1, 0})
+	img, err := decodeTGA(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := img.(*image.Paletted)
+	if !ok || p.ColorIndexAt(0, 0) != 1 || p.ColorIndexAt(1, 0) != 0 {
+		t.Fatalf("got %T %v", img, img)
+	}
+	// Indexes outside the colour map are invalid.
+	b[len(b)-1] = 2
+	if _, err := decodeTGA(bytes.NewReader(b)); err != errTGA {
+		t.Errorf("got %v, want %v", err, errTGA)
+	}
+}
+
+func TestDecodeTGACorrupt(t *testing.T) {
+	for _, typ := range []uint8{tgaGrey, tgaGrey | tgaRLE} {
+		// The header claims a huge image, but the data ends right away.
+		h := tgaHeader{ImageType: typ, Width: 65535, Height: 65535, PixelDepth: 8}
+		if _, err := decodeTGA(bytes.NewReader(tgaFile(h, nil, []byte{0xff, 0}))); err == nil {
+			t.Errorf("type %d: no error", typ)
+		}
+	}
+	h := tgaHeader{ImageType: tgaGrey | tgaRLE, Width: 4, Height: 1, PixelDepth: 8}
+	b := tgaFile(h, nil, []byte{0x83, 9})
+	for n := 0; n < len(b); n++ {
+		if _, err := decodeTGA(bytes.NewReader(b[:n])); err == nil {
+			t.Errorf("%d bytes: no error", n)
+		}
+	}
+	h.ImageType = 4
+	if _, err := decodeTGA(bytes.NewReader(tgaFile(h, nil, []byte{0x83, 9}))); err == nil {
+		t.Error("unsupported type: no error")
+	}
+}
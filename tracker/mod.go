@@ -0,0 +1,143 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// modChannels returns the number of channels for a MOD signature or 0 if unknown.
+func modChannels(sig string) int {
+	switch sig {
+	case "M.K.", "M!K!", "FLT4", "4CHN":
+		return 4
+	case "FLT8", "OCTA", "CD81":
+		return 8
+	}
+	if strings.HasSuffix(sig, "CHN") {
+		n, _ := strconv.Atoi(sig[:1])
+		return n
+	}
+	if strings.HasSuffix(sig, "CH") || strings.HasSuffix(sig, "CN") {
+		n, _ := strconv.Atoi(sig[:2])
+		if n > 32 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+// modPeriodToNote converts an Amiga period to a note.
+// Period 428 (C-2 in ProTracker) is note 49 (C-4).
+func modPeriodToNote(period int) int {
+	if period == 0 {
+		return NoNote
+	}
+	n := 49 + int(math.Floor(12*math.Log2(428/float64(period))+0.5))
+	if n < 1 || n > maxNote {
+		return NoNote
+	}
+	return n
+}
+
+func trimName(b []byte) string {
+	return strings.TrimRight(string(b), "\x00 ")
+}
+
+func decodeMOD(b []byte) (*Module, error) {
+	const (
+		samples     = 31
+		sampleHdr   = 30
+		ordersStart = 20 + samples*sampleHdr
+	)
+	channels := modChannels(string(b[1080:1084]))
+	m := Module{
+		Format:   "mod",
+		Title:    trimName(b[:20]),
+		Channels: channels,
+		Speed:    6,
+		Tempo:    125,
+	}
+	songLen := int(b[ordersStart])
+	if songLen == 0 || songLen > 128 {
+		return nil, ErrFormat
+	}
+	nPatterns := 0
+	for i := 0; i < 128; i++ {
+		o := int(b[ordersStart+2+i])
+		if i < songLen {
+			m.Orders = append(m.Orders, o)
+		}
+		// Patterns stored are based on all 128 entries.
+		if o+1 > nPatterns {
+			nPatterns = o + 1
+		}
+	}
+	// Amiga panning is LRRL.
+	for i := 0; i < channels; i++ {
+		if i&3 == 0 || i&3 == 3 {
+			m.Panning = append(m.Panning, 0x20)
+		} else {
+			m.Panning = append(m.Panning, 0xe0)
+		}
+	}
+
+	off := 1084
+	patSize := 64 * channels * 4
+	if off+nPatterns*patSize > len(b) {
+		return nil, ErrFormat
+	}
+	for p := 0; p < nPatterns; p++ {
+		pat := Pattern{Rows: 64, Cells: make([]Cell, 64*channels)}
+		data := b[off : off+patSize]
+		for i := range pat.Cells {
+			c := data[i*4 : i*4+4]
+			period := int(c[0]&0x0f)<<8 | int(c[1])
+			pat.Cells[i] = Cell{
+				Note:       uint8(modPeriodToNote(period)),
+				Instrument: c[0]&0xf0 | c[2]>>4,
+				Effect:     c[2] & 0x0f,
+				Param:      c[3],
+			}
+		}
+		m.Patterns = append(m.Patterns, pat)
+		off += patSize
+	}
+
+	for i := 0; i < samples; i++ {
+		h := b[20+i*sampleHdr : 20+(i+1)*sampleHdr]
+		length := int(binary.BigEndian.Uint16(h[22:])) * 2
+		ft := int(h[24] & 0x0f)
+		if ft > 7 {
+			ft -= 16
+		}
+		s := &Sample{
+			Name:      trimName(h[:22]),
+			Volume:    int(h[25]),
+			Finetune:  ft * 16,
+			LoopStart: int(binary.BigEndian.Uint16(h[26:])) * 2,
+			LoopLen:   int(binary.BigEndian.Uint16(h[28:])) * 2,
+			Panning:   128,
+		}
+		if s.Volume > 64 {
+			s.Volume = 64
+		}
+		if length > len(b)-off {
+			length = len(b) - off
+		}
+		s.Data = make([]float32, length)
+		for j := range s.Data {
+			s.Data[j] = float32(int8(b[off+j])) / 128
+		}
+		off += length
+		if s.LoopLen <= 2 || s.LoopStart >= length {
+			s.LoopStart, s.LoopLen = 0, 0
+		} else if s.LoopStart+s.LoopLen > length {
+			s.LoopLen = length - s.LoopStart
+		}
+		m.Instruments = append(m.Instruments, &Instrument{Name: s.Name, Samples: []*Sample{s}})
+	}
+	return &m, nil
+}
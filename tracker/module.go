@@ -0,0 +1,167 @@
+// Package tracker decodes and plays ProTracker MOD and FastTracker 2 XM modules.
+//
+// Playback is done in pure Go and is deterministic,
+// so a module rendered offline will always produce the same output.
+package tracker
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Note values with special meaning.
+const (
+	NoNote  = 0
+	KeyOff  = 97
+	maxNote = 96
+)
+
+// Cell is a single entry in a pattern.
+type Cell struct {
+	// Note is 1 -> 96 (C-0 -> B-7), KeyOff or NoNote.
+	Note uint8
+
+	// Instrument is 1 based, 0 means no instrument.
+	Instrument uint8
+
+	// Volume is the XM volume column. 0 is empty.
+	Volume uint8
+
+	Effect, Param uint8
+}
+
+// Pattern is a number of rows with one cell per channel.
+type Pattern struct {
+	Rows  int
+	Cells []Cell
+}
+
+// Sample is a single sample.
+type Sample struct {
+	Name string
+
+	// Data contains the sample values, -1 -> 1.
+	Data []float32
+
+	// LoopStart and LoopLen are in samples. If LoopLen is 0, the sample isn't looped.
+	LoopStart, LoopLen int
+	PingPong           bool
+
+	// Volume is 0 -> 64.
+	Volume int
+
+	// Finetune is -128 -> 127, 128 steps per semitone.
+	Finetune int
+
+	// RelNote is added to the note played.
+	RelNote int
+
+	// Panning is 0 (left) -> 255 (right).
+	Panning int
+}
+
+// EnvPoint is a point on an envelope.
+type EnvPoint struct {
+	Tick  int
+	Value int
+}
+
+// Envelope is a volume or panning envelope. Values are 0 -> 64.
+type Envelope struct {
+	Points []EnvPoint
+	On     bool
+
+	SustainOn bool
+	Sustain   int
+
+	LoopOn             bool
+	LoopStart, LoopEnd int
+}
+
+// Instrument is one or more samples mapped to notes.
+type Instrument struct {
+	Name    string
+	Samples []*Sample
+
+	// Keymap contains the sample index for each note.
+	Keymap [maxNote]uint8
+
+	VolEnv, PanEnv Envelope
+
+	// Fadeout is subtracted from a volume of 32768 every tick after key off.
+	Fadeout int
+}
+
+// sample returns the sample used for the note, or nil.
+func (i *Instrument) sample(note int) *Sample {
+	if note < 1 || note > maxNote {
+		return nil
+	}
+	idx := int(i.Keymap[note-1])
+	if idx >= len(i.Samples) {
+		return nil
+	}
+	return i.Samples[idx]
+}
+
+// Module is a decoded module.
+type Module struct {
+	// Format is "mod" or "xm".
+	Format string
+	Title  string
+
+	Channels int
+	Orders   []int
+	// Restart is the order to restart from when the song loops.
+	Restart int
+
+	Patterns    []Pattern
+	Instruments []*Instrument
+
+	// Linear is set if the module uses linear frequencies.
+	// Otherwise Amiga periods are used.
+	Linear bool
+
+	// Initial speed (ticks per row) and tempo (BPM).
+	Speed, Tempo int
+
+	// Panning is the initial panning of each channel, 0 -> 255.
+	Panning []int
+}
+
+// ErrFormat is returned when the data isn't a supported module.
+var ErrFormat = errors.New("tracker: unsupported format")
+
+// Detect returns "mod" or "xm" if b looks like a module, otherwise "".
+func Detect(b []byte) string {
+	if bytes.HasPrefix(b, []byte(xmMagic)) {
+		return "xm"
+	}
+	if len(b) >= 1084 && modChannels(string(b[1080:1084])) > 0 {
+		return "mod"
+	}
+	return ""
+}
+
+// Decode a MOD or XM module.
+func Decode(b []byte) (*Module, error) {
+	switch Detect(b) {
+	case "xm":
+		return decodeXM(b)
+	case "mod":
+		return decodeMOD(b)
+	}
+	return nil, ErrFormat
+}
+
+// pattern returns the pattern at order position o or nil.
+func (m *Module) pattern(o int) *Pattern {
+	if o < 0 || o >= len(m.Orders) {
+		return nil
+	}
+	p := m.Orders[o]
+	if p < 0 || p >= len(m.Patterns) {
+		return nil
+	}
+	return &m.Patterns[p]
+}
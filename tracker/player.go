@@ -0,0 +1,828 @@
+package tracker
+
+import (
+	"math"
+
+	"github.com/klauspost/gfx/internal/pcm"
+)
+
+// Position is a position in a module.
+type Position struct {
+	// Order is the index in Module.Orders and Pattern the pattern played.
+	Order, Pattern int
+	Row, Tick      int
+}
+
+// NoteEvent is a cell with a note or instrument on a channel.
+type NoteEvent struct {
+	Channel int
+	Cell
+}
+
+// RowInfo describes a row as it starts playing.
+type RowInfo struct {
+	Position
+
+	// Sample is the number of samples rendered by the player before the row starts.
+	Sample int64
+
+	// Speed (ticks per row) and Tempo (BPM) of the row.
+	Speed, Tempo int
+
+	// Events contains the cells with notes, key offs or instruments.
+	// Delayed notes are included when the row starts.
+	Events []NoteEvent
+}
+
+// Player renders a module.
+type Player struct {
+	m          *Module
+	sampleRate int
+
+	// Loop will make the song restart when it ends.
+	// Otherwise Render will stop at the end of the song.
+	Loop bool
+
+	// OnRow is called when a row starts, before any samples of the row are rendered.
+	OnRow func(r RowInfo)
+
+	speed, tempo int
+	globalVol    int
+	order, row   int
+	tick         int
+	patDelay     int
+	tickLeft     float64
+	jump         bool
+	patLoop      bool
+	jumpOrder    int
+	jumpRow      int
+	ended        bool
+	rendered     int64
+	visited      map[int]bool
+	ch           []channel
+	cells        []Cell
+}
+
+type channel struct {
+	inst *Instrument
+	smp  *Sample
+
+	note     int
+	finetune int
+	period   float64
+	target   float64
+	out      float64 // Period with vibrato and arpeggio applied.
+
+	pos    float64
+	back   bool
+	active bool
+
+	volume, outVol int
+	pan            int
+	keyOn          bool
+	fade           int
+	volEnv, panEnv int
+	gainL, gainR   float64
+
+	vibPos, vibSpeed, vibDepth    int
+	tremPos, tremSpeed, tremDepth int
+
+	// Effect memory.
+	portaUp, portaDown, portaSpeed int
+	fineUp, fineDown               int
+	xfineUp, xfineDown             int
+	volSlide, fineVolUp, fineVolDn int
+	panSlide, globalSlide          int
+	offset, retrig                 int
+
+	loopRow, loopCount int
+	delayed            Cell
+}
+
+// NewPlayer returns a player that renders the module with the given sample rate.
+func NewPlayer(m *Module, sampleRate int) *Player {
+	p := &Player{
+		m:          m,
+		sampleRate: sampleRate,
+		speed:      m.Speed,
+		tempo:      m.Tempo,
+		globalVol:  64,
+		visited:    make(map[int]bool),
+		ch:         make([]channel, m.Channels),
+		cells:      make([]Cell, m.Channels),
+	}
+	for i := range p.ch {
+		p.ch[i].pan = 128
+		if i < len(m.Panning) {
+			p.ch[i].pan = m.Panning[i]
+		}
+	}
+	if len(m.Orders) == 0 {
+		p.ended = true
+	}
+	p.visited[0] = true
+	return p
+}
+
+// Position returns the position of the next sample to be rendered.
+func (p *Player) Position() Position {
+	return Position{Order: p.order, Pattern: p.patternIndex(), Row: p.row, Tick: p.tick}
+}
+
+// Ended returns true if the song has ended.
+func (p *Player) Ended() bool {
+	return p.ended
+}
+
+func (p *Player) patternIndex() int {
+	if p.order < len(p.m.Orders) {
+		return p.m.Orders[p.order]
+	}
+	return -1
+}
+
+func (p *Player) xm() bool {
+	return p.m.Format == "xm"
+}
+
+// Render stereo samples into buf.
+// The number of samples rendered is returned,
+// which is less than len(buf) only when the song has ended.
+func (p *Player) Render(buf [][2]float64) int {
+	gain := 2 / math.Max(float64(p.m.Channels), 2)
+	n := 0
+	for n < len(buf) {
+		if p.tickLeft <= 0 {
+			if p.ended {
+				break
+			}
+			p.doTick()
+			p.tickLeft += float64(p.sampleRate) * 2.5 / float64(p.tempo)
+		}
+		todo := int(math.Ceil(p.tickLeft))
+		if todo > len(buf)-n {
+			todo = len(buf) - n
+		}
+		out := buf[n : n+todo]
+		for i := range out {
+			out[i] = [2]float64{}
+		}
+		for i := range p.ch {
+			p.ch[i].mix(out, float64(p.sampleRate), p)
+		}
+		for i := range out {
+			out[i][0] = clamp(out[i][0]*gain, -1, 1)
+			out[i][1] = clamp(out[i][1]*gain, -1, 1)
+		}
+		p.tickLeft -= float64(todo)
+		p.rendered += int64(todo)
+		n += todo
+	}
+	return n
+}
+
+func clamp(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// doTick processes a single tick.
+func (p *Player) doTick() {
+	if p.tick == 0 {
+		p.startRow()
+	} else {
+		for i := range p.ch {
+			p.tickEffects(&p.ch[i], p.cells[i], p.tick%p.speed)
+		}
+	}
+	for i := range p.ch {
+		p.updateChannel(&p.ch[i])
+	}
+	p.tick++
+	if p.tick >= p.speed*(1+p.patDelay) {
+		p.tick = 0
+		p.patDelay = 0
+		p.nextRow()
+	}
+}
+
+func (p *Player) startRow() {
+	pat := p.m.pattern(p.order)
+	info := RowInfo{
+		Position: p.Position(),
+		Sample:   p.rendered,
+	}
+	for i := range p.cells {
+		p.cells[i] = Cell{}
+		if pat != nil && p.row < pat.Rows {
+			p.cells[i] = pat.Cells[p.row*p.m.Channels+i]
+		}
+		c := p.cells[i]
+		if c.Note != NoNote || c.Instrument != 0 {
+			info.Events = append(info.Events, NoteEvent{Channel: i, Cell: c})
+		}
+	}
+	p.jump, p.patLoop = false, false
+	p.jumpOrder, p.jumpRow = p.order+1, 0
+	for i := range p.ch {
+		p.rowEffects(&p.ch[i], p.cells[i])
+	}
+	info.Speed, info.Tempo = p.speed, p.tempo
+	if p.OnRow != nil {
+		p.OnRow(info)
+	}
+}
+
+func (p *Player) nextRow() {
+	prevOrder := p.order
+	jumped := p.jump && !p.patLoop
+	switch {
+	case p.patLoop:
+		p.row = p.jumpRow
+	case p.jump:
+		p.order, p.row = p.jumpOrder, p.jumpRow
+	default:
+		p.row++
+		if pat := p.m.pattern(p.order); pat == nil || p.row >= pat.Rows {
+			p.order++
+			p.row = 0
+		}
+	}
+	if p.order >= len(p.m.Orders) {
+		if !p.Loop {
+			p.ended = true
+			return
+		}
+		p.order = p.m.Restart
+	}
+	if pat := p.m.pattern(p.order); pat != nil && p.row >= pat.Rows {
+		p.row = 0
+	}
+	if p.order == prevOrder && !jumped {
+		return
+	}
+	// Detect songs that loop by jumping back.
+	key := p.order<<16 | p.row
+	if p.visited[key] {
+		if !p.Loop {
+			p.ended = true
+			return
+		}
+		p.visited = make(map[int]bool)
+	}
+	p.visited[key] = true
+}
+
+// period returns the period of a note in FastTracker 2 units.
+func (p *Player) period(note, finetune int) float64 {
+	if p.m.Linear {
+		return 7680 - float64(note-1)*64 - float64(finetune)/2
+	}
+	return 1712 * math.Pow(2, -float64(note-49)/12-float64(finetune)/1536)
+}
+
+// frequency returns the sample frequency of a period.
+func (p *Player) frequency(period float64) float64 {
+	if p.m.Linear {
+		return 8363 * math.Pow(2, (4608-period)/768)
+	}
+	if period < 1 {
+		period = 1
+	}
+	return 8363 * 1712 / period
+}
+
+// clampPeriod limits the period after slides.
+func (p *Player) clampPeriod(period float64) float64 {
+	switch {
+	case p.m.Format == "mod":
+		return clamp(period, 113*4, 856*4)
+	case p.m.Linear:
+		return clamp(period, 1, 7680)
+	}
+	return clamp(period, 1, 32000)
+}
+
+// memory returns the parameter, or the last non-zero parameter in XM modules.
+func (p *Player) memory(last *int, param int) int {
+	if param != 0 {
+		*last = param
+	}
+	if p.xm() {
+		return *last
+	}
+	return param
+}
+
+// finetune converts an E5x finetune value.
+func (p *Player) finetune(x int) int {
+	if p.xm() {
+		return (x - 8) * 16
+	}
+	if x > 7 {
+		x -= 16
+	}
+	return x * 16
+}
+
+func hasTonePorta(c Cell) bool {
+	return c.Effect == 3 || c.Effect == 5 || c.Volume >= 0xf0
+}
+
+// trigger plays a note.
+func (p *Player) trigger(ch *channel, c Cell) {
+	note := int(c.Note)
+	if c.Instrument != 0 {
+		ch.inst = nil
+		if i := int(c.Instrument) - 1; i < len(p.m.Instruments) {
+			ch.inst = p.m.Instruments[i]
+		}
+	}
+	if note == KeyOff {
+		ch.keyOn = false
+		if ch.inst == nil || !ch.inst.VolEnv.On {
+			ch.volume = 0
+		}
+		return
+	}
+	if note != NoNote && ch.inst != nil {
+		smp := ch.inst.sample(note)
+		if hasTonePorta(c) && ch.active && ch.smp != nil {
+			ch.target = p.period(note+ch.smp.RelNote, ch.finetune)
+		} else if smp != nil {
+			ch.smp = smp
+			ch.note = note
+			ch.finetune = smp.Finetune
+			if c.Effect == 0xe && c.Param>>4 == 5 {
+				ch.finetune = p.finetune(int(c.Param & 0xf))
+			}
+			ch.period = p.period(note+smp.RelNote, ch.finetune)
+			ch.target = ch.period
+			ch.pos, ch.back = 0, false
+			ch.active = len(smp.Data) > 0
+			ch.vibPos, ch.tremPos = 0, 0
+		} else {
+			ch.active = false
+		}
+	}
+	if c.Instrument != 0 && ch.smp != nil {
+		ch.volume = ch.smp.Volume
+		if p.xm() {
+			ch.pan = ch.smp.Panning
+		}
+		ch.keyOn = true
+		ch.fade = 32768
+		ch.volEnv, ch.panEnv = 0, 0
+	}
+}
+
+// rowEffects handles the first tick of a row.
+func (p *Player) rowEffects(ch *channel, c Cell) {
+	ch.out = ch.period
+	ch.outVol = ch.volume
+	param := int(c.Param)
+	x, y := param>>4, param&0xf
+	if c.Effect == 0xe && x == 0xd && y > 0 {
+		// Note delay.
+		ch.delayed = c
+	} else {
+		p.trigger(ch, c)
+		p.volumeColumn(ch, c.Volume, true)
+	}
+
+	switch c.Effect {
+	case 3:
+		if param != 0 {
+			ch.portaSpeed = param * 4
+		}
+	case 4:
+		if x != 0 {
+			ch.vibSpeed = x
+		}
+		if y != 0 {
+			ch.vibDepth = y
+		}
+	case 7:
+		if x != 0 {
+			ch.tremSpeed = x
+		}
+		if y != 0 {
+			ch.tremDepth = y
+		}
+	case 5, 6, 0xa:
+		ch.volSlide = p.memory(&ch.volSlide, param)
+	case 8:
+		ch.pan = param
+	case 9:
+		if ch.active && ch.smp != nil && c.Note != NoNote {
+			ch.pos = float64(p.memory(&ch.offset, param) * 256)
+			if int(ch.pos) >= len(ch.smp.Data) {
+				ch.active = false
+			}
+		}
+	case 0xb:
+		p.jump, p.jumpOrder = true, param
+	case 0xc:
+		ch.volume = clampInt(param, 0, 64)
+		ch.outVol = ch.volume
+	case 0xd:
+		p.jump, p.jumpRow = true, x*10+y
+	case 0xe:
+		switch x {
+		case 1:
+			ch.period = p.clampPeriod(ch.period - float64(p.memory(&ch.fineUp, y)*4))
+		case 2:
+			ch.period = p.clampPeriod(ch.period + float64(p.memory(&ch.fineDown, y)*4))
+		case 6:
+			if y == 0 {
+				ch.loopRow = p.row
+			} else if ch.loopCount == 0 {
+				ch.loopCount = y
+				p.patLoop, p.jumpRow = true, ch.loopRow
+			} else if ch.loopCount--; ch.loopCount > 0 {
+				p.patLoop, p.jumpRow = true, ch.loopRow
+			}
+		case 8:
+			ch.pan = y * 17
+		case 0xa:
+			ch.volume = clampInt(ch.volume+p.memory(&ch.fineVolUp, y), 0, 64)
+		case 0xb:
+			ch.volume = clampInt(ch.volume-p.memory(&ch.fineVolDn, y), 0, 64)
+		case 0xc:
+			if y == 0 {
+				ch.volume = 0
+			}
+		case 0xe:
+			if p.patDelay == 0 {
+				p.patDelay = y
+			}
+		}
+		ch.outVol = ch.volume
+	case 0xf:
+		switch {
+		case param == 0:
+		case param < 32:
+			p.speed = param
+		default:
+			p.tempo = param
+		}
+	case 16: // G: Global volume
+		p.globalVol = clampInt(param, 0, 64)
+	case 17: // H: Global volume slide
+		p.memory(&ch.globalSlide, param)
+	case 20: // K: Key off
+		if param == 0 {
+			p.trigger(ch, Cell{Note: KeyOff})
+		}
+	case 21: // L: Envelope position
+		ch.volEnv, ch.panEnv = param, param
+	case 25: // P: Panning slide
+		p.memory(&ch.panSlide, param)
+	case 27: // R: Multi retrig
+		p.memory(&ch.retrig, param)
+	case 33: // X: Extra fine porta
+		switch x {
+		case 1:
+			ch.period = p.clampPeriod(ch.period - float64(p.memory(&ch.xfineUp, y)))
+		case 2:
+			ch.period = p.clampPeriod(ch.period + float64(p.memory(&ch.xfineDown, y)))
+		}
+	}
+	ch.out = ch.period
+}
+
+// volumeColumn handles the XM volume column.
+func (p *Player) volumeColumn(ch *channel, v uint8, first bool) {
+	x := int(v & 0xf)
+	switch {
+	case v >= 0x10 && v <= 0x50:
+		if first {
+			ch.volume = int(v) - 0x10
+		}
+	case v >= 0x60 && v < 0x80:
+		if !first {
+			if v < 0x70 {
+				ch.volume = clampInt(ch.volume-x, 0, 64)
+			} else {
+				ch.volume = clampInt(ch.volume+x, 0, 64)
+			}
+		}
+	case v >= 0x80 && v < 0xa0:
+		if first {
+			if v < 0x90 {
+				ch.volume = clampInt(ch.volume-x, 0, 64)
+			} else {
+				ch.volume = clampInt(ch.volume+x, 0, 64)
+			}
+		}
+	case v >= 0xa0 && v < 0xb0:
+		if first && x != 0 {
+			ch.vibSpeed = x
+		}
+	case v >= 0xb0 && v < 0xc0:
+		if first && x != 0 {
+			ch.vibDepth = x
+		}
+		if !first {
+			p.vibrato(ch)
+		}
+	case v >= 0xc0 && v < 0xd0:
+		if first {
+			ch.pan = x * 17
+		}
+	case v >= 0xd0 && v < 0xf0:
+		if !first {
+			if v < 0xe0 {
+				ch.pan = clampInt(ch.pan-x, 0, 255)
+			} else {
+				ch.pan = clampInt(ch.pan+x, 0, 255)
+			}
+		}
+	case v >= 0xf0:
+		if first && x != 0 {
+			ch.portaSpeed = x * 16 * 4
+		}
+		if !first {
+			p.tonePorta(ch)
+		}
+	}
+	ch.outVol = ch.volume
+}
+
+func (p *Player) tonePorta(ch *channel) {
+	if ch.period < ch.target {
+		ch.period = math.Min(ch.period+float64(ch.portaSpeed), ch.target)
+	} else if ch.period > ch.target {
+		ch.period = math.Max(ch.period-float64(ch.portaSpeed), ch.target)
+	}
+	ch.out = ch.period
+}
+
+func (p *Player) vibrato(ch *channel) {
+	s := math.Sin(2 * math.Pi * float64(ch.vibPos) / 64)
+	ch.out = ch.period + s*255*float64(ch.vibDepth)/32
+	ch.vibPos = (ch.vibPos + ch.vibSpeed) & 63
+}
+
+func (p *Player) volSlide(ch *channel) {
+	x, y := ch.volSlide>>4, ch.volSlide&0xf
+	if x != 0 {
+		ch.volume = clampInt(ch.volume+x, 0, 64)
+	} else {
+		ch.volume = clampInt(ch.volume-y, 0, 64)
+	}
+	ch.outVol = ch.volume
+}
+
+// tickEffects handles ticks after the first in a row.
+func (p *Player) tickEffects(ch *channel, c Cell, tick int) {
+	ch.out = ch.period
+	ch.outVol = ch.volume
+	param := int(c.Param)
+	x, y := param>>4, param&0xf
+	if ch.delayed != (Cell{}) && tick == y && c.Effect == 0xe && x == 0xd {
+		p.trigger(ch, ch.delayed)
+		p.volumeColumn(ch, ch.delayed.Volume, true)
+		ch.delayed = Cell{}
+	} else {
+		p.volumeColumn(ch, c.Volume, false)
+	}
+
+	switch c.Effect {
+	case 0:
+		if param != 0 {
+			semis := [3]int{0, x, y}[tick%3]
+			if p.m.Linear {
+				ch.out = ch.period - float64(semis*64)
+			} else {
+				ch.out = ch.period * math.Pow(2, -float64(semis)/12)
+			}
+		}
+	case 1:
+		ch.period = p.clampPeriod(ch.period - float64(p.memory(&ch.portaUp, param)*4))
+		ch.out = ch.period
+	case 2:
+		ch.period = p.clampPeriod(ch.period + float64(p.memory(&ch.portaDown, param)*4))
+		ch.out = ch.period
+	case 3:
+		p.tonePorta(ch)
+	case 4:
+		p.vibrato(ch)
+	case 5:
+		p.tonePorta(ch)
+		p.volSlide(ch)
+	case 6:
+		p.vibrato(ch)
+		p.volSlide(ch)
+	case 7:
+		s := math.Sin(2 * math.Pi * float64(ch.tremPos) / 64)
+		ch.outVol = clampInt(ch.volume+int(s*255*float64(ch.tremDepth)/64), 0, 64)
+		ch.tremPos = (ch.tremPos + ch.tremSpeed) & 63
+	case 0xa:
+		p.volSlide(ch)
+	case 0xe:
+		switch x {
+		case 9:
+			if y != 0 && tick%y == 0 {
+				ch.pos, ch.back = 0, false
+				ch.active = ch.smp != nil && len(ch.smp.Data) > 0
+			}
+		case 0xc:
+			if tick == y {
+				ch.volume, ch.outVol = 0, 0
+			}
+		}
+	case 17: // H: Global volume slide
+		gx, gy := ch.globalSlide>>4, ch.globalSlide&0xf
+		if gx != 0 {
+			p.globalVol = clampInt(p.globalVol+gx, 0, 64)
+		} else {
+			p.globalVol = clampInt(p.globalVol-gy, 0, 64)
+		}
+	case 20: // K: Key off
+		if tick == param {
+			p.trigger(ch, Cell{Note: KeyOff})
+		}
+	case 25: // P: Panning slide
+		px, py := ch.panSlide>>4, ch.panSlide&0xf
+		if px != 0 {
+			ch.pan = clampInt(ch.pan+px, 0, 255)
+		} else {
+			ch.pan = clampInt(ch.pan-py, 0, 255)
+		}
+	case 27: // R: Multi retrig
+		rx, ry := ch.retrig>>4, ch.retrig&0xf
+		if ry != 0 && tick%ry == 0 {
+			ch.pos, ch.back = 0, false
+			switch {
+			case rx >= 1 && rx <= 5:
+				ch.volume -= 1 << uint(rx-1)
+			case rx == 6:
+				ch.volume = ch.volume * 2 / 3
+			case rx == 7:
+				ch.volume /= 2
+			case rx >= 9 && rx <= 0xd:
+				ch.volume += 1 << uint(rx-9)
+			case rx == 0xe:
+				ch.volume = ch.volume * 3 / 2
+			case rx == 0xf:
+				ch.volume *= 2
+			}
+			ch.volume = clampInt(ch.volume, 0, 64)
+			ch.outVol = ch.volume
+		}
+	}
+}
+
+// value returns the envelope value at a tick.
+func (e *Envelope) value(tick int) int {
+	pts := e.Points
+	if tick <= pts[0].Tick {
+		return pts[0].Value
+	}
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		if tick < b.Tick {
+			if b.Tick == a.Tick {
+				return b.Value
+			}
+			return a.Value + (b.Value-a.Value)*(tick-a.Tick)/(b.Tick-a.Tick)
+		}
+	}
+	return pts[len(pts)-1].Value
+}
+
+// advance returns the envelope tick after tick.
+func (e *Envelope) advance(tick int, keyOn bool) int {
+	if e.SustainOn && keyOn && tick == e.Points[e.Sustain].Tick {
+		return tick
+	}
+	tick++
+	if e.LoopOn && tick >= e.Points[e.LoopEnd].Tick {
+		tick = e.Points[e.LoopStart].Tick
+	}
+	return tick
+}
+
+// updateChannel applies envelopes and calculates the channel gain.
+func (p *Player) updateChannel(ch *channel) {
+	vol := float64(ch.outVol) / 64
+	pan := ch.pan
+	if inst := ch.inst; inst != nil && p.xm() {
+		if inst.VolEnv.On {
+			vol *= float64(inst.VolEnv.value(ch.volEnv)) / 64
+			ch.volEnv = inst.VolEnv.advance(ch.volEnv, ch.keyOn)
+		}
+		if inst.PanEnv.On {
+			env := inst.PanEnv.value(ch.panEnv)
+			d := pan - 128
+			if d < 0 {
+				d = -d
+			}
+			pan = clampInt(pan+(env-32)*(128-d)/32, 0, 255)
+			ch.panEnv = inst.PanEnv.advance(ch.panEnv, ch.keyOn)
+		}
+		if !ch.keyOn {
+			vol *= float64(ch.fade) / 32768
+			ch.fade -= inst.Fadeout
+			if ch.fade < 0 {
+				ch.fade = 0
+			}
+		}
+	}
+	vol *= float64(p.globalVol) / 64
+	ch.gainL = vol * float64(255-pan) / 255
+	ch.gainR = vol * float64(pan) / 255
+}
+
+// mix adds the channel output to out.
+func (ch *channel) mix(out [][2]float64, sampleRate float64, p *Player) {
+	s := ch.smp
+	if !ch.active || s == nil || (ch.gainL == 0 && ch.gainR == 0 && s.LoopLen > 0) {
+		return
+	}
+	step := p.frequency(ch.out) / sampleRate
+	data := s.Data
+	loopEnd := float64(s.LoopStart + s.LoopLen)
+	for i := range out {
+		idx := int(ch.pos)
+		if idx >= len(data) || idx < 0 {
+			ch.active = false
+			return
+		}
+		next := idx + 1
+		switch {
+		case ch.back:
+			next = idx - 1
+			if next < s.LoopStart {
+				next = idx
+			}
+		case s.LoopLen > 0 && next >= s.LoopStart+s.LoopLen:
+			next = s.LoopStart
+			if s.PingPong {
+				next = idx
+			}
+		case next >= len(data):
+			next = idx
+		}
+		frac := ch.pos - float64(idx)
+		if ch.back {
+			frac = float64(idx) + 1 - ch.pos
+			if frac >= 1 {
+				frac = 0
+			}
+		}
+		v := float64(data[idx]) + (float64(data[next])-float64(data[idx]))*frac
+		out[i][0] += v * ch.gainL
+		out[i][1] += v * ch.gainR
+
+		if ch.back {
+			ch.pos -= step
+			if ch.pos < float64(s.LoopStart) {
+				ch.pos = 2*float64(s.LoopStart) - ch.pos
+				ch.back = false
+			}
+			continue
+		}
+		ch.pos += step
+		if s.LoopLen > 0 && ch.pos >= loopEnd {
+			if s.PingPong {
+				ch.pos = 2*loopEnd - ch.pos
+				if ch.pos >= loopEnd {
+					ch.pos = loopEnd - 1
+				}
+				ch.back = true
+			} else {
+				for ch.pos >= loopEnd {
+					ch.pos -= float64(s.LoopLen)
+				}
+			}
+		}
+	}
+}
+
+// RenderPCM renders the rest of the song to interleaved 16 bit stereo samples.
+func (p *Player) RenderPCM() []int16 {
+	return pcm.Int16(p.Render, p.sampleRate)
+}
+
+// RenderPCM renders the module offline to interleaved 16 bit stereo samples.
+// The module is played once.
+func (m *Module) RenderPCM(sampleRate int) []int16 {
+	return NewPlayer(m, sampleRate).RenderPCM()
+}
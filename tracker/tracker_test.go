@@ -0,0 +1,221 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"runtime"
+	"testing"
+)
+
+// testMOD returns a 4 channel MOD with a square wave sample.
+// Order 0 plays rows 0 -> 10 of pattern 0, which breaks to row 60 of order 1.
+func testMOD() []byte {
+	b := make([]byte, 1084+1024+64)
+	copy(b, "test")
+	h := b[20:]
+	copy(h, "square")
+	binary.BigEndian.PutUint16(h[22:], 32) // Length in words.
+	h[25] = 64                             // Volume.
+	binary.BigEndian.PutUint16(h[28:], 32) // Loop length.
+	b[950] = 2
+	copy(b[1080:], "M.K.")
+	pat := b[1084:]
+	// Row 0, channel 0: sample 1 at period 428.
+	copy(pat, []byte{0x01, 0xac, 0x10, 0x00})
+	// Row 1, channel 1: the same note with arpeggio.
+	copy(pat[16+4:], []byte{0x01, 0xac, 0x10, 0x37})
+	// Row 10, channel 2: pattern break to row 60.
+	copy(pat[10*16+8:], []byte{0x00, 0x00, 0x0d, 0x60})
+	for i := 0; i < 64; i++ {
+		v := int8(100)
+		if i >= 32 {
+			v = -100
+		}
+		b[1084+1024+i] = byte(v)
+	}
+	return b
+}
+
+// testXM returns a 2 channel XM with one 4 row pattern.
+// The note on row 0 is released on row 2 and faded out by the volume envelope.
+func testXM() []byte {
+	var b bytes.Buffer
+	le := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("Extended Module: ")
+	b.Write(make([]byte, 20))
+	b.WriteByte(0x1a)
+	b.Write(make([]byte, 20))
+	le(uint16(0x104))
+	le(uint32(276))
+	le(uint16(1)) // Song length.
+	le(uint16(0))
+	le(uint16(2)) // Channels.
+	le(uint16(1)) // Patterns.
+	le(uint16(1)) // Instruments.
+	le(uint16(1)) // Linear frequencies.
+	le(uint16(3)) // Speed.
+	le(uint16(125))
+	b.Write(make([]byte, 256))
+
+	var pd bytes.Buffer
+	pd.Write([]byte{0x80 | 0x1 | 0x2 | 0x4, 49, 1, 0x40})
+	pd.WriteByte(0x80)
+	for r := 1; r < 4; r++ {
+		if r == 2 {
+			pd.Write([]byte{0x80 | 1, KeyOff})
+		} else {
+			pd.WriteByte(0x80)
+		}
+		pd.WriteByte(0x80)
+	}
+	le(uint32(9))
+	b.WriteByte(0)
+	le(uint16(4))
+	le(uint16(pd.Len()))
+	b.Write(pd.Bytes())
+
+	le(uint32(263))
+	b.Write(make([]byte, 22))
+	b.WriteByte(0)
+	le(uint16(1))
+	le(uint32(40))
+	b.Write(make([]byte, 96))
+	// Volume envelope with 3 points, then the unused points.
+	pts := []uint16{0, 64, 2, 32, 4, 0}
+	for i := 0; i < 12; i++ {
+		if i < 3 {
+			le(pts[i*2])
+			le(pts[i*2+1])
+		} else {
+			le(uint32(0))
+		}
+	}
+	b.Write(make([]byte, 48))
+	b.WriteByte(3)
+	b.WriteByte(0)
+	b.Write([]byte{1, 0, 0, 0, 0, 0})
+	b.Write([]byte{1 | 2, 0})
+	b.Write(make([]byte, 4))
+	le(uint16(0x400))
+	b.Write(make([]byte, 263-241))
+
+	le(uint32(64)) // Sample length in bytes.
+	le(uint32(0))
+	le(uint32(32))
+	b.WriteByte(64)
+	b.WriteByte(0)
+	b.WriteByte(0x10 | 2) // 16 bit, ping-pong loop.
+	b.WriteByte(128)
+	b.WriteByte(0)
+	b.WriteByte(0)
+	b.Write(make([]byte, 22))
+	prev := int16(0)
+	for i := 0; i < 32; i++ {
+		v := int16(20000)
+		if i >= 16 {
+			v = -20000
+		}
+		le(v - prev)
+		prev = v
+	}
+	return b.Bytes()
+}
+
+// pcmHash returns a hash of the samples.
+func pcmHash(pcm []int16) string {
+	h := sha1.New()
+	binary.Write(h, binary.LittleEndian, pcm)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkHash compares the hash of the samples with want.
+// Other architectures may fuse floating point operations,
+// so the output is only compared on amd64.
+func checkHash(t *testing.T, pcm []int16, want string) {
+	t.Helper()
+	if runtime.GOARCH != "amd64" {
+		return
+	}
+	if got := pcmHash(pcm); got != want {
+		t.Errorf("got hash %s, want %s", got, want)
+	}
+}
+
+func TestRenderMOD(t *testing.T) {
+	b := testMOD()
+	if Detect(b) != "mod" {
+		t.Fatal("not detected as mod")
+	}
+	m, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []RowInfo
+	p := NewPlayer(m, 44100)
+	p.OnRow = func(r RowInfo) { rows = append(rows, r) }
+	pcm := p.RenderPCM()
+
+	// 11 rows of order 0 and 4 rows of order 1, 6 ticks of 882 samples.
+	if len(rows) != 15 {
+		t.Fatalf("got %d rows, want 15", len(rows))
+	}
+	if len(pcm) != 15*6*882*2 {
+		t.Fatalf("got %d samples, want %d", len(pcm)/2, 15*6*882)
+	}
+	if pcmHash(m.RenderPCM(44100)) != pcmHash(pcm) {
+		t.Fatal("rendering is not deterministic")
+	}
+	var peak int16
+	for _, v := range pcm {
+		if v > peak {
+			peak = v
+		}
+	}
+	if peak == 0 {
+		t.Fatal("silent output")
+	}
+	checkHash(t, pcm, "f6d8eb3ae7138525eca38d8ef54fb63aa3bac7f0")
+}
+
+func TestRenderXM(t *testing.T) {
+	m, err := Decode(testXM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := m.Instruments[0].Samples[0]
+	if !m.Linear || len(s.Data) != 32 || s.Data[20] > -0.5 {
+		t.Fatalf("bad sample: %v", s.Data)
+	}
+	pcm := m.RenderPCM(44100)
+	// The first row plays and the last row is faded out.
+	var peak [4]int16
+	per := len(pcm) / 4
+	for i, v := range pcm {
+		if v > peak[i/per] {
+			peak[i/per] = v
+		}
+	}
+	if peak[0] == 0 || peak[3] != 0 {
+		t.Fatalf("unexpected levels per row: %v", peak)
+	}
+	checkHash(t, pcm, "2865e75588f27b578a807b6424a8c79b7fa6427e")
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for _, b := range [][]byte{testMOD(), testXM()} {
+		for n := 0; n < len(b); n++ {
+			_, err := Decode(b[:n])
+			if err != nil && err != ErrFormat {
+				t.Errorf("%d bytes: got error %v, want ErrFormat", n, err)
+			}
+		}
+	}
+	if _, err := Decode(testMOD()[:1084]); err != ErrFormat {
+		t.Errorf("MOD without patterns: got %v, want ErrFormat", err)
+	}
+	if _, err := Decode(testXM()[:60]); err != ErrFormat {
+		t.Errorf("XM header only: got %v, want ErrFormat", err)
+	}
+}
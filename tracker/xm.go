@@ -0,0 +1,214 @@
+package tracker
+
+import (
+	"encoding/binary"
+)
+
+const xmMagic = "Extended Module: "
+
+// xmReader reads little endian values and remembers if it ran out of data.
+type xmReader struct {
+	b   []byte
+	off int
+	eof bool
+}
+
+func (r *xmReader) bytes(n int) []byte {
+	if n < 0 || r.off+n > len(r.b) {
+		r.eof = true
+		r.off = len(r.b)
+		return make([]byte, n&0xffffff)
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *xmReader) u8() int  { return int(r.bytes(1)[0]) }
+func (r *xmReader) u16() int { return int(binary.LittleEndian.Uint16(r.bytes(2))) }
+func (r *xmReader) u32() int { return int(binary.LittleEndian.Uint32(r.bytes(4))) }
+
+func decodeXM(b []byte) (*Module, error) {
+	r := &xmReader{b: b}
+	r.bytes(len(xmMagic))
+	m := Module{Format: "xm", Title: trimName(r.bytes(20))}
+	r.bytes(1 + 20)
+	version := r.u16()
+	if version < 0x0104 {
+		// Older versions store data in a different order.
+		return nil, ErrFormat
+	}
+	hdrStart := r.off
+	hdrSize := r.u32()
+	songLen := r.u16()
+	m.Restart = r.u16()
+	m.Channels = r.u16()
+	nPatterns := r.u16()
+	nInstruments := r.u16()
+	m.Linear = r.u16()&1 != 0
+	m.Speed = r.u16()
+	m.Tempo = r.u16()
+	orders := r.bytes(256)
+	if r.eof || m.Channels == 0 || m.Channels > 64 || songLen > 256 {
+		return nil, ErrFormat
+	}
+	for _, o := range orders[:songLen] {
+		m.Orders = append(m.Orders, int(o))
+	}
+	for i := 0; i < m.Channels; i++ {
+		m.Panning = append(m.Panning, 128)
+	}
+	r.off = hdrStart + hdrSize
+
+	for p := 0; p < nPatterns; p++ {
+		start := r.off
+		hdrLen := r.u32()
+		r.u8() // Packing type, always 0.
+		rows := r.u16()
+		size := r.u16()
+		r.off = start + hdrLen
+		pat := Pattern{Rows: rows, Cells: make([]Cell, rows*m.Channels)}
+		data := r.bytes(size)
+		if r.eof {
+			return nil, ErrFormat
+		}
+		for i := 0; i < len(pat.Cells) && len(data) > 0; i++ {
+			var c Cell
+			flags := data[0]
+			if flags&0x80 == 0 {
+				// Uncompressed, all fields present.
+				flags = 0x1f
+			} else {
+				data = data[1:]
+			}
+			fields := []*uint8{&c.Note, &c.Instrument, &c.Volume, &c.Effect, &c.Param}
+			for bit, f := range fields {
+				if flags&(1<<uint(bit)) != 0 && len(data) > 0 {
+					*f = data[0]
+					data = data[1:]
+				}
+			}
+			if c.Note > KeyOff {
+				c.Note = NoNote
+			}
+			pat.Cells[i] = c
+		}
+		m.Patterns = append(m.Patterns, pat)
+	}
+
+	for i := 0; i < nInstruments; i++ {
+		start := r.off
+		size := r.u32()
+		inst := &Instrument{Name: trimName(r.bytes(22))}
+		r.u8() // Type
+		nSamples := r.u16()
+		if r.eof {
+			return nil, ErrFormat
+		}
+		m.Instruments = append(m.Instruments, inst)
+		if nSamples == 0 {
+			r.off = start + size
+			continue
+		}
+		r.u32() // Sample header size
+		copy(inst.Keymap[:], r.bytes(maxNote))
+		readPoints := func() []EnvPoint {
+			pts := make([]EnvPoint, 12)
+			for j := range pts {
+				pts[j] = EnvPoint{Tick: r.u16(), Value: r.u16()}
+			}
+			return pts
+		}
+		volPts, panPts := readPoints(), readPoints()
+		nVol, nPan := r.u8(), r.u8()
+		if nVol > 12 {
+			nVol = 12
+		}
+		if nPan > 12 {
+			nPan = 12
+		}
+		inst.VolEnv.Points, inst.PanEnv.Points = volPts[:nVol], panPts[:nPan]
+		inst.VolEnv.Sustain, inst.VolEnv.LoopStart, inst.VolEnv.LoopEnd = r.u8(), r.u8(), r.u8()
+		inst.PanEnv.Sustain, inst.PanEnv.LoopStart, inst.PanEnv.LoopEnd = r.u8(), r.u8(), r.u8()
+		setType := func(e *Envelope, t int) {
+			e.On = t&1 != 0 && len(e.Points) > 0
+			e.SustainOn = t&2 != 0 && e.Sustain < len(e.Points)
+			e.LoopOn = t&4 != 0 && e.LoopStart <= e.LoopEnd && e.LoopEnd < len(e.Points)
+		}
+		setType(&inst.VolEnv, r.u8())
+		setType(&inst.PanEnv, r.u8())
+		r.bytes(4) // Auto vibrato
+		inst.Fadeout = r.u16()
+		r.off = start + size
+
+		type sampleHdr struct {
+			length int
+			bits16 bool
+		}
+		hdrs := make([]sampleHdr, nSamples)
+		for j := range hdrs {
+			s := &Sample{}
+			length := r.u32()
+			s.LoopStart = r.u32()
+			s.LoopLen = r.u32()
+			s.Volume = r.u8()
+			s.Finetune = int(int8(r.u8()))
+			typ := r.u8()
+			s.Panning = r.u8()
+			s.RelNote = int(int8(r.u8()))
+			r.u8()
+			s.Name = trimName(r.bytes(22))
+			if s.Volume > 64 {
+				s.Volume = 64
+			}
+			switch typ & 3 {
+			case 0:
+				s.LoopStart, s.LoopLen = 0, 0
+			case 2:
+				s.PingPong = true
+			}
+			hdrs[j] = sampleHdr{length: length, bits16: typ&16 != 0}
+			inst.Samples = append(inst.Samples, s)
+		}
+		for j, h := range hdrs {
+			s := inst.Samples[j]
+			data := r.bytes(h.length)
+			if r.eof {
+				return nil, ErrFormat
+			}
+			// Samples are delta encoded.
+			if h.bits16 {
+				s.Data = make([]float32, len(data)/2)
+				var v int16
+				for k := range s.Data {
+					v += int16(binary.LittleEndian.Uint16(data[k*2:]))
+					s.Data[k] = float32(v) / 32768
+				}
+				s.LoopStart /= 2
+				s.LoopLen /= 2
+			} else {
+				s.Data = make([]float32, len(data))
+				var v int8
+				for k := range s.Data {
+					v += int8(data[k])
+					s.Data[k] = float32(v) / 128
+				}
+			}
+			if s.LoopStart >= len(s.Data) {
+				s.LoopStart, s.LoopLen = 0, 0
+			} else if s.LoopStart+s.LoopLen > len(s.Data) {
+				s.LoopLen = len(s.Data) - s.LoopStart
+			}
+		}
+	}
+	if m.Speed == 0 {
+		m.Speed = 6
+	}
+	if m.Tempo == 0 {
+		m.Tempo = 125
+	}
+	if m.Restart >= len(m.Orders) {
+		m.Restart = 0
+	}
+	return &m, nil
+}